@@ -0,0 +1,34 @@
+package pgxbatcher
+
+import (
+	"github.com/jackc/pgx/v5"
+)
+
+// Collected holds the rows collected from a statement queued with QueueCollect or QueueCollectFunc.
+type Collected[T any] struct {
+	*StatementResult
+	rows []T
+}
+
+// Rows returns the collected rows. It is nil until the batch has been executed.
+func (c *Collected[T]) Rows() []T {
+	return c.rows
+}
+
+// QueueCollect adds a statement to b whose rows are collected into a []T with pgx.RowToStructByName when the batch is
+// executed.
+func QueueCollect[T any](b *PGXBatcher, sql string, args []any) *Collected[T] {
+	return QueueCollectFunc(b, sql, args, pgx.RowToStructByName[T])
+}
+
+// QueueCollectFunc adds a statement to b whose rows are collected with fn when the batch is executed, e.g. with
+// pgx.RowToAddrOfStructByPos or pgx.RowTo.
+func QueueCollectFunc[T any](b *PGXBatcher, sql string, args []any, fn pgx.RowToFunc[T]) *Collected[T] {
+	c := &Collected[T]{}
+	c.StatementResult = b.QueueQuery(sql, args, func(rows pgx.Rows) error {
+		var err error
+		c.rows, err = pgx.CollectRows(rows, fn)
+		return err
+	})
+	return c
+}
@@ -0,0 +1,221 @@
+package pgxbatcher
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrCollectorClosed = errors.New("collector is closed")
+
+// Collector coalesces statements submitted by many goroutines into batches. A batch is flushed once it holds the
+// configured number of statements or the linger time since its first statement has passed, whichever comes first.
+// Flushes happen one at a time, so the connection is never used concurrently by the Collector.
+//
+// Each flush is executed by a PGXBatcher in ContinueOnError mode, so a failing statement does not affect statements
+// submitted by other callers. This can be changed with WithBatchOptions.
+type Collector struct {
+	conn         BatchSender
+	opts         []Option
+	flushSize    int
+	linger       time.Duration
+	flushTimeout time.Duration
+
+	mu      sync.Mutex
+	pending []*Future
+	timer   *time.Timer
+	closed  bool
+
+	flush chan struct{}
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// CollectorOption configures a Collector created with NewCollector.
+type CollectorOption func(*Collector)
+
+// WithFlushSize sets the number of statements that causes a batch to be flushed. It defaults to 100.
+func WithFlushSize(n int) CollectorOption {
+	return func(c *Collector) {
+		c.flushSize = n
+	}
+}
+
+// WithLinger sets how long a batch waits for further statements after its first statement was submitted. It
+// defaults to 5ms.
+func WithLinger(d time.Duration) CollectorOption {
+	return func(c *Collector) {
+		c.linger = d
+	}
+}
+
+// WithFlushTimeout limits how long a single flush may take. There is no limit by default.
+func WithFlushTimeout(d time.Duration) CollectorOption {
+	return func(c *Collector) {
+		c.flushTimeout = d
+	}
+}
+
+// WithBatchOptions sets options for the PGXBatcher that executes each flushed batch.
+func WithBatchOptions(opts ...Option) CollectorOption {
+	return func(c *Collector) {
+		c.opts = append(c.opts, opts...)
+	}
+}
+
+// Future is the pending result of a statement submitted to a Collector.
+type Future struct {
+	sql  string
+	args []any
+
+	done chan struct{}
+	res  *StatementResult
+	err  error
+}
+
+// Done returns a channel that is closed once the statement has been executed.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait waits until the statement has been executed or ctx is done. If the statement failed, the error is a
+// *StatementError, or the error of the batch if the failure is not attributable to the statement. The statement's
+// position in the flushed batch is of no use to the caller, so the Index of the result and of a *StatementError is
+// zero.
+func (f *Future) Wait(ctx context.Context) (*StatementResult, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-f.done:
+		return f.res, f.err
+	}
+}
+
+func (f *Future) resolve(res *StatementResult, err error) {
+	f.res = res
+	f.err = err
+	close(f.done)
+}
+
+// NewCollector creates a Collector that executes batches on conn and starts its background flushing. Close must be
+// called to stop it.
+func NewCollector(conn BatchSender, opts ...CollectorOption) *Collector {
+	c := &Collector{
+		conn:      conn,
+		opts:      []Option{WithErrorMode(ContinueOnError)},
+		flushSize: 100,
+		linger:    5 * time.Millisecond,
+		flush:     make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	go c.run()
+	return c
+}
+
+// Submit queues a statement for the next batch and returns a Future for its result. It is safe for concurrent use.
+func (c *Collector) Submit(sql string, args ...any) *Future {
+	f := &Future{sql: sql, args: args, done: make(chan struct{})}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		f.resolve(nil, ErrCollectorClosed)
+		return f
+	}
+
+	c.pending = append(c.pending, f)
+	if len(c.pending) >= c.flushSize {
+		c.signal()
+	} else if len(c.pending) == 1 {
+		c.timer = time.AfterFunc(c.linger, c.signal)
+	}
+	return f
+}
+
+// Close flushes the statements submitted so far and stops the Collector. Statements submitted after Close fail with
+// ErrCollectorClosed.
+func (c *Collector) Close() {
+	c.mu.Lock()
+	if !c.closed {
+		c.closed = true
+		close(c.stop)
+	}
+	c.mu.Unlock()
+
+	<-c.done
+}
+
+func (c *Collector) signal() {
+	select {
+	case c.flush <- struct{}{}:
+	default:
+	}
+}
+
+func (c *Collector) run() {
+	defer close(c.done)
+	for {
+		select {
+		case <-c.flush:
+			c.flushPending()
+		case <-c.stop:
+			c.flushPending()
+			return
+		}
+	}
+}
+
+func (c *Collector) flushPending() {
+	c.mu.Lock()
+	futures := c.pending
+	c.pending = nil
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	c.mu.Unlock()
+
+	for len(futures) > 0 {
+		n := min(len(futures), max(c.flushSize, 1))
+		c.execute(futures[:n])
+		futures = futures[n:]
+	}
+}
+
+func (c *Collector) execute(futures []*Future) {
+	ctx := context.Background()
+	if c.flushTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.flushTimeout)
+		defer cancel()
+	}
+
+	b := NewWithOptions(c.conn, c.opts...)
+	for _, f := range futures {
+		b.Queue(f.sql, f.args...)
+	}
+	err := b.Execute(ctx)
+
+	for i, f := range futures {
+		res := b.statements[i].result
+		res.Index = 0
+		switch {
+		case res.Err != nil:
+			stmtErr := b.statementError(i)
+			stmtErr.Index = 0
+			f.resolve(res, stmtErr)
+		case err != nil && (b.transactional || !res.Executed):
+			// the statement was rolled back with the rest of the transaction or never sent
+			f.resolve(res, err)
+		default:
+			f.resolve(res, nil)
+		}
+	}
+}
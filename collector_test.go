@@ -0,0 +1,72 @@
+package pgxbatcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestCollector(t *testing.T) {
+	t.Cleanup(func() { truncateUsers(t) })
+
+	c := NewCollector(conn, WithFlushSize(10), WithLinger(10*time.Millisecond))
+
+	var wg sync.WaitGroup
+	errs := make([]error, 25)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var f *Future
+			if i == 7 {
+				f = c.Submit("SELECT $1::int / 0", i)
+			} else {
+				name := fmt.Sprintf("user%d", i)
+				f = c.Submit("INSERT INTO users (name, email) VALUES ($1, $2)", name, name+"@example.com")
+			}
+			res, err := f.Wait(context.TODO())
+			if err == nil && (res.RowsAffected != 1 || res.Index != 0) {
+				err = fmt.Errorf("expected 1 row affected at index 0, got %d at index %d", res.RowsAffected, res.Index)
+			}
+			errs[i] = err
+		}()
+	}
+	wg.Wait()
+	c.Close()
+
+	for i, err := range errs {
+		if i == 7 {
+			var pgErr *pgconn.PgError
+			if !errors.As(err, &pgErr) || pgErr.Code != "22012" { // division_by_zero
+				t.Errorf("expected division_by_zero error for statement %d, got %v", i, err)
+			}
+			var stmtErr *StatementError
+			if !errors.As(err, &stmtErr) || stmtErr.Index != 0 {
+				t.Errorf("expected a statement error at index 0 for statement %d, got %v", i, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error for statement %d: %v", i, err)
+		}
+	}
+
+	var count int
+	err := conn.QueryRow(context.TODO(), "SELECT COUNT(*) FROM users").Scan(&count)
+	if err != nil {
+		t.Fatalf("Failed to query test table: %v", err)
+	}
+	if count != 24 {
+		t.Errorf("Expected 24 rows in test table, got %d", count)
+	}
+
+	_, err = c.Submit("SELECT 1").Wait(context.TODO())
+	if !errors.Is(err, ErrCollectorClosed) {
+		t.Errorf("expected ErrCollectorClosed, got %v", err)
+	}
+}
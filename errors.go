@@ -2,15 +2,85 @@ package pgxbatcher
 
 import (
 	"errors"
+	"fmt"
 )
 
 var (
-	ErrEmptyBatch    = errors.New("no queries to execute")
-	ErrExecutedBatch = errors.New("this batch has already been executed. Create a new instance or call Reset()")
+	ErrEmptyBatch      = errors.New("no queries to execute")
+	ErrExecutedBatch   = errors.New("this batch has already been executed. Create a new instance or call Reset()")
+	ErrCopyUnsupported = errors.New("the connection does not support COPY")
+	// ErrPrepareUnsupported is returned by Validate if the connection cannot describe statements.
+	ErrPrepareUnsupported = errors.New("the connection does not support Prepare")
+	// ErrPipelineUnsupported is returned by Execute if WithPipeline is set and the connection does not give access to
+	// its *pgconn.PgConn.
+	ErrPipelineUnsupported = errors.New("the connection does not support pipeline mode")
+	// ErrInvalidRef is wrapped by the error returned by Execute if a Ref cannot be resolved.
+	ErrInvalidRef = errors.New("invalid Ref")
+	// ErrNotMarshalable is wrapped by the error returned by MarshalBinary if a statement or argument cannot be encoded.
+	ErrNotMarshalable = errors.New("cannot marshal statement")
+	// ErrInvalidEncoding is wrapped by the error returned by UnmarshalBinary if the data was not encoded by
+	// MarshalBinary or is corrupt.
+	ErrInvalidEncoding = errors.New("invalid batch encoding")
 )
 
+// ErrUnexpectedRowCount is matched by errors.Is for a *RowCountError.
+var ErrUnexpectedRowCount = errors.New("unexpected number of rows affected")
+
+// RowCountError is returned for a statement queued with ExpectRows that affected a different number of rows.
+type RowCountError struct {
+	Expected int64
+	Actual   int64
+}
+
+func (e *RowCountError) Error() string {
+	return fmt.Sprintf("%v: expected %d, got %d", ErrUnexpectedRowCount, e.Expected, e.Actual)
+}
+
+func (e *RowCountError) Unwrap() error {
+	return ErrUnexpectedRowCount
+}
+
 type StatementErrors []error
 
 func (e StatementErrors) Error() string {
 	return errors.Join(e...).Error()
 }
+
+// Unwrap allows errors.Is and errors.As to inspect each statement error.
+func (e StatementErrors) Unwrap() []error {
+	return e
+}
+
+// StatementError describes a queued statement that failed. Err is typically a *pgconn.PgError.
+type StatementError struct {
+	// Index is the position of the statement in the batch, starting at zero.
+	Index int
+	// SQL is the statement as it was queued.
+	SQL string
+	// Args are the statement's arguments as returned by the batch's Redactor. By default their values are replaced by
+	// their types.
+	Args []any
+	Err  error
+}
+
+func (e *StatementError) Error() string {
+	return fmt.Sprintf("statement %d (%s): %v", e.Index, e.SQL, e.Err)
+}
+
+func (e *StatementError) Unwrap() error {
+	return e.Err
+}
+
+// Redactor returns the arguments of the statement sql in a form that is safe to log, e.g. with sensitive values
+// masked. It must not modify args.
+type Redactor func(sql string, args []any) []any
+
+// redactArgs replaces each argument with a placeholder naming its type so that errors can be logged without leaking
+// values. It is the default Redactor.
+func redactArgs(_ string, args []any) []any {
+	redacted := make([]any, len(args))
+	for i, arg := range args {
+		redacted[i] = fmt.Sprintf("<%T>", arg)
+	}
+	return redacted
+}
@@ -0,0 +1,754 @@
+package pgxbatcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// savepoint is the name of the savepoint that wraps each statement of a transactional batch in ContinueOnError mode.
+const savepoint = "pgxbatcher"
+
+// step is a statement sent as part of a batch. It executes the queued statements at indexes, usually just one. A
+// step with several indexes executes a single statement rewritten from them, see mergeInsertSteps and chainSteps.
+// Statements such as BEGIN that are added by the batcher have no indexes.
+type step struct {
+	indexes []int
+	sql     string
+	args    []any
+	// chained is set for a step executing a chain of statements linked by Refs. The last of its indexes is the
+	// statement whose result it returns.
+	chained bool
+}
+
+func control(sql string) step {
+	return step{sql: sql}
+}
+
+func (p *PGXBatcher) Execute(ctx context.Context) error {
+	if len(p.queries) < 1 {
+		return ErrEmptyBatch
+	}
+	if p.executed {
+		return ErrExecutedBatch
+	}
+	if !p.supportsCopy() && p.hasCopy() {
+		return ErrCopyUnsupported
+	}
+	if err := p.checkRefs(); err != nil {
+		return err
+	}
+	if p.pipeline && !p.supportsPipeline() {
+		return ErrPipelineUnsupported
+	}
+	p.executed = true
+
+	start := time.Now()
+	if p.tracer != nil {
+		ctx = p.tracer.TraceBatchStart(ctx, TraceBatchStartData{Batch: p.batch, Transactional: p.transactional})
+	}
+	err := p.dispatch(ctx)
+	switch {
+	case p.alreadyApplied(err):
+		err = fmt.Errorf("%w: %s", ErrAlreadyApplied, p.idempotencyKey)
+	case p.spool != nil && !p.inTx && ctx.Err() == nil && isConnectionError(err):
+		err = p.spoolBatch(err)
+	}
+	if p.tracer != nil {
+		p.tracer.TraceBatchEnd(ctx, TraceBatchEndData{Err: err})
+	}
+	duration := time.Since(start)
+	p.log(ctx, duration, err)
+	p.observe(duration, err)
+	return err
+}
+
+// dispatch executes the batch on the batcher's connection. A pool hands out a different connection for every
+// SendBatch, so a connection is acquired for the whole batch, or for each chunk if chunks are sent concurrently.
+func (p *PGXBatcher) dispatch(ctx context.Context) error {
+	if pool, ok := p.conn.(acquirer); ok {
+		if p.concurrentChunks > 1 && !p.transactional && !p.pipeline {
+			return p.executeConcurrent(ctx, pool)
+		}
+
+		c, err := pool.Acquire(ctx)
+		if err != nil {
+			return err
+		}
+		defer c.Release()
+		return p.on(c).executeWithRetry(ctx)
+	}
+	return p.executeWithRetry(ctx)
+}
+
+// executeWithRetry executes the batch, replaying it according to the retry policy if it fails with a transient error.
+func (p *PGXBatcher) executeWithRetry(ctx context.Context) error {
+	for retry := 1; ; retry++ {
+		err := p.execute(ctx)
+		if err == nil || !p.transactional || p.inTx || p.hasCopy() || !p.retryPolicy.retryable(err) || retry >= p.retryPolicy.MaxAttempts {
+			return err
+		}
+		if p.retryPolicy.wait(ctx, retry) != nil {
+			return err
+		}
+		for _, s := range p.statements {
+			s.result.reset()
+		}
+	}
+}
+
+func (p *PGXBatcher) execute(ctx context.Context) error {
+	switch {
+	case p.errorMode == ContinueOnError && p.transactional:
+		return p.executeSavepoints(ctx)
+	case p.pipeline && !p.hasCopy():
+		return p.executePipeline(ctx)
+	case p.errorMode == ContinueOnError:
+		return p.executeContinue(ctx)
+	}
+
+	chunks := p.chunks(p.plan())
+	completed := 0
+	for c, chunk := range chunks {
+		steps := chunk
+		if c == 0 {
+			steps = append(p.begin(), steps...)
+		}
+		if c == len(chunks)-1 && !p.deferCommit() {
+			steps = append(steps, p.commit()...)
+		}
+
+		failed, k, err := p.runSteps(ctx, steps)
+		if err != nil {
+			p.rollback(ctx)
+			// pgx reports a statement that it cannot prepare against the first step. A transaction passed to
+			// NewInTx has been aborted by the failure, so the statements cannot be described within it.
+			if k == 0 && !p.inTx {
+				failed = p.blame(ctx, chunk, failed)
+			}
+			if len(failed.indexes) > 0 {
+				err = p.statementErrors(failed.indexes)
+			}
+			p.reportProgress(c, chunk, completed, err)
+			return err
+		}
+
+		completed += countStatements(chunk)
+		p.reportProgress(c, chunk, completed, nil)
+	}
+
+	return p.commitDeferred(ctx)
+}
+
+// executeContinue executes a non-transactional batch until every statement has been attempted. Each chunk is
+// executed on its own, see executeChunkContinue.
+func (p *PGXBatcher) executeContinue(ctx context.Context) error {
+	var failures []int
+	completed := 0
+	for c, chunk := range p.chunks(p.plan()) {
+		chunkFailures := p.executeChunkContinue(ctx, chunk)
+		failures = append(failures, chunkFailures...)
+		completed += countStatements(chunk)
+		p.reportProgress(c, chunk, completed, p.statementErrors(chunkFailures))
+	}
+
+	return p.statementErrors(failures)
+}
+
+// executeChunkContinue executes steps until every one of them has been attempted and returns the indexes of the
+// failed statements. pgx sends a batch as a single implicit transaction, so when the server rejects a statement the
+// statements before it are rolled back and the ones after it are skipped. Both are sent again without the failed
+// statement until a batch succeeds.
+func (p *PGXBatcher) executeChunkContinue(ctx context.Context, steps []step) []int {
+	var failures []int
+	pending := steps
+	described := false
+
+	for len(pending) > 0 {
+		failed, k, err := p.runSteps(ctx, pending)
+		if err == nil {
+			failures = append(failures, p.callbackFailures(pending)...)
+			break
+		}
+
+		var pgErr *pgconn.PgError
+		if k == 0 && len(pending) > 1 && !described {
+			// Errors raised while pgx prepares the batch or encodes its arguments are reported against its first
+			// statement, so the distinct statements are described once to drop every statement that cannot be sent.
+			described = true
+			if errs, ok := p.unsendable(ctx, pending); ok && len(errs) > 0 {
+				var kept []step
+				for j, s := range pending {
+					if err, ok := errs[j]; ok {
+						p.failStep(s, err)
+						failures = append(failures, s.indexes...)
+						continue
+					}
+					p.resetResults(s)
+					kept = append(kept, s)
+				}
+				pending = kept
+				continue
+			}
+		}
+		if errors.As(err, &pgErr) && k == 0 && len(pending) > 1 {
+			// The statement the error is reported against may not be the one at fault, so run it on its own to find
+			// out.
+			failed, err = p.run(ctx, pending[:1])
+			if err == nil {
+				failures = append(failures, p.callbackFailures(pending[:1])...)
+				pending = pending[1:]
+				continue
+			}
+		}
+
+		failures = append(failures, failed.indexes...)
+		if !errors.As(err, &pgErr) {
+			// The error did not come from the server or a callback, e.g. a lost connection, so the state of the
+			// remaining statements is unknown.
+			break
+		}
+
+		for _, s := range pending[:k] {
+			p.resetResults(s)
+		}
+		pending = append(pending[:k:k], pending[k+1:]...)
+	}
+
+	return failures
+}
+
+// callbackFailures returns the indexes of the statements of steps that failed in a callback, see readOn.
+func (p *PGXBatcher) callbackFailures(steps []step) []int {
+	var failures []int
+	for _, s := range steps {
+		for _, i := range s.indexes {
+			if p.statements[i].result.Err != nil {
+				failures = append(failures, i)
+			}
+		}
+	}
+	return failures
+}
+
+// unsendable describes the distinct statements of steps and encodes their arguments, as pgx does before it sends a
+// batch, and returns the errors of the statements that fail by their position in steps. It returns false if the
+// connection cannot describe statements or an error did not come from the server.
+func (p *PGXBatcher) unsendable(ctx context.Context, steps []step) (map[int]error, bool) {
+	conn, ok := p.preparer()
+	if !ok {
+		return nil, false
+	}
+	m := p.typeMap()
+
+	descriptions := map[string]description{}
+	errs := map[int]error{}
+	for k, s := range steps {
+		if p.isCopy(s) {
+			continue
+		}
+		sql, args, err := p.stepQuery(ctx, s)
+		if err != nil {
+			errs[k] = err
+			continue
+		}
+
+		d, described := descriptions[sql]
+		if !described {
+			d.sd, d.err = conn.Prepare(ctx, "", sql)
+			var pgErr *pgconn.PgError
+			if d.err != nil && !errors.As(d.err, &pgErr) {
+				return nil, false
+			}
+			descriptions[sql] = d
+		}
+		if d.err != nil {
+			errs[k] = d.err
+			continue
+		}
+
+		var eqb pgx.ExtendedQueryBuilder
+		if err := eqb.Build(m, d.sd, args); err != nil {
+			errs[k] = err
+		}
+	}
+	return errs, true
+}
+
+// dropUnsendable returns the statements of steps that cannot be sent, see unsendable, and the remaining steps. Within
+// a transaction passed to NewInTx the statements are described inside a savepoint, so that a statement that cannot be
+// prepared does not abort the transaction.
+func (p *PGXBatcher) dropUnsendable(ctx context.Context, steps []step) ([]int, []step, error) {
+	if p.inTx {
+		if _, err := p.run(ctx, []step{control("SAVEPOINT " + savepoint)}); err != nil {
+			return nil, nil, err
+		}
+	}
+	errs, _ := p.unsendable(ctx, steps)
+	if p.inTx {
+		if _, err := p.run(ctx, []step{control("ROLLBACK TO SAVEPOINT " + savepoint), control("RELEASE SAVEPOINT " + savepoint)}); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var failures []int
+	var kept []step
+	for k, s := range steps {
+		if err, ok := errs[k]; ok {
+			p.failStep(s, err)
+			failures = append(failures, s.indexes...)
+			continue
+		}
+		kept = append(kept, s)
+	}
+	return failures, kept, nil
+}
+
+// blame returns the step of chunk that caused the failure that pgx reported against failed, the first step read back
+// from a round trip. pgx prepares the statements of a batch and encodes their arguments before sending it, and reports
+// a failure to do so against the first step, so the steps of chunk are described to find the one at fault. failed is
+// returned if none is found. The connection must not be in a failed transaction.
+func (p *PGXBatcher) blame(ctx context.Context, chunk []step, failed step) step {
+	errs, ok := p.unsendable(ctx, chunk)
+	if !ok {
+		return failed
+	}
+	for k, s := range chunk {
+		if err, ok := errs[k]; ok {
+			p.resetResults(failed)
+			p.failStep(s, err)
+			return s
+		}
+	}
+	return failed
+}
+
+// failStep records err as the result of the statements executed by s.
+func (p *PGXBatcher) failStep(s step, err error) {
+	for _, i := range s.indexes {
+		res := p.statements[i].result
+		res.Executed = true
+		res.Err = err
+	}
+}
+
+// executeSavepoints executes a transactional batch with each statement wrapped in a savepoint. A failed statement
+// aborts the transaction on the server and causes the rest of the batch to be skipped, so the savepoint is rolled
+// back in a separate round trip and the statements after the failed one are sent again.
+//
+// pgx prepares the statements of a batch before sending it, and a statement that cannot be prepared would abort the
+// transaction outside of any savepoint, so the statements are described up front and those that cannot be sent are
+// reported without being sent.
+func (p *PGXBatcher) executeSavepoints(ctx context.Context) error {
+	failures, pending, err := p.dropUnsendable(ctx, p.plan())
+	if err != nil {
+		return err
+	}
+	steps := p.begin()
+	completed := len(failures)
+
+	for c := 0; ; c++ {
+		chunk := p.nextChunk(pending)
+		for _, s := range chunk {
+			steps = append(steps, control("SAVEPOINT "+savepoint), s, control("RELEASE SAVEPOINT "+savepoint))
+		}
+		if len(chunk) == len(pending) && !p.deferCommit() {
+			steps = append(steps, p.commit()...)
+		}
+
+		failed, err := p.run(ctx, steps)
+		if err == nil {
+			pending = pending[len(chunk):]
+			if len(chunk) > 0 {
+				completed += countStatements(chunk)
+				p.reportProgress(c, chunk, completed, nil)
+			}
+			if len(pending) == 0 {
+				break
+			}
+			steps = nil
+			continue
+		}
+
+		// A retryable error such as a serialization failure dooms the whole transaction, so it isn't rolled back to
+		// the savepoint but returned to be retried.
+		var pgErr *pgconn.PgError
+		if len(failed.indexes) == 0 || !errors.As(err, &pgErr) || p.retryPolicy.retryable(err) {
+			p.rollback(ctx)
+			if len(failed.indexes) > 0 {
+				err = p.statementErrors(append(failures, failed.indexes...))
+			}
+			p.reportProgress(c, chunk, completed, err)
+			return err
+		}
+		failures = append(failures, failed.indexes...)
+
+		if _, err := p.run(ctx, []step{control("ROLLBACK TO SAVEPOINT " + savepoint)}); err != nil {
+			p.rollback(ctx)
+			return err
+		}
+
+		k := slices.IndexFunc(chunk, func(s step) bool { return s.indexes[0] == failed.indexes[0] }) + 1
+		completed += countStatements(chunk[:k])
+		p.reportProgress(c, chunk[:k], completed, p.statementErrors(failed.indexes))
+		pending = pending[k:]
+		steps = []step{control("RELEASE SAVEPOINT " + savepoint)}
+	}
+
+	if err := p.commitDeferred(ctx); err != nil {
+		return err
+	}
+	return p.statementErrors(failures)
+}
+
+// run sends steps as a single batch and reads their results. If a step fails, it is returned along with the error.
+func (p *PGXBatcher) run(ctx context.Context, steps []step) (step, error) {
+	failed, _, err := p.runSteps(ctx, steps)
+	return failed, err
+}
+
+// runSteps is like run but also returns the position of the failed step in steps. Steps are sent in a single batch
+// unless they contain a COPY, which is run on its own between the batches of the steps before and after it.
+func (p *PGXBatcher) runSteps(ctx context.Context, steps []step) (step, int, error) {
+	for start := 0; start < len(steps); {
+		if p.isCopy(steps[start]) {
+			err := p.runCopy(ctx, steps[start].indexes[0])
+			p.traceStatements(ctx, steps[start])
+			if err != nil {
+				return steps[start], start, err
+			}
+			start++
+			continue
+		}
+
+		end := start + 1
+		for end < len(steps) && !p.isCopy(steps[end]) {
+			end++
+		}
+		if k, err := p.runBatch(ctx, steps[start:end]); err != nil {
+			return steps[start+k], start + k, err
+		}
+		start = end
+	}
+
+	return step{}, -1, nil
+}
+
+// runBatch sends steps as a single batch and reads their results. If a step fails, its position in steps is returned
+// along with the error, unless the results after it are read on, see readOn.
+func (p *PGXBatcher) runBatch(ctx context.Context, steps []step) (int, error) {
+	b := &pgx.Batch{}
+	for _, s := range steps {
+		if len(s.indexes) == 1 && s.sql == "" {
+			// pgx modifies queued queries while sending them, so send a copy.
+			qq := p.batch.QueuedQueries[s.indexes[0]]
+			b.QueuedQueries = append(b.QueuedQueries, &pgx.QueuedQuery{SQL: qq.SQL, Arguments: qq.Arguments, Fn: qq.Fn})
+			continue
+		}
+		b.Queue(s.sql, s.args...)
+	}
+
+	results := p.conn.SendBatch(ctx, b)
+	defer results.Close()
+
+	for k, s := range steps {
+		err := p.read(results, s)
+		p.traceStatements(ctx, s)
+		if err != nil && !p.readOn(s) {
+			return k, err
+		}
+	}
+
+	return -1, nil
+}
+
+// readOn reports whether the results of the steps after s are read although s failed. An error returned by a callback
+// does not come from the server, which has executed the whole round trip, so in a non-transactional batch in
+// ContinueOnError mode the remaining results are read and the failure is left in the result of s.
+func (p *PGXBatcher) readOn(s step) bool {
+	return p.errorMode == ContinueOnError && !p.transactional && p.callbackFailed(s)
+}
+
+// callbackFailed reports whether s failed because a callback reading its result returned an error.
+func (p *PGXBatcher) callbackFailed(s step) bool {
+	if len(s.indexes) == 0 {
+		return false
+	}
+	return p.statements[s.indexes[len(s.indexes)-1]].result.callbackErr
+}
+
+// runCopy runs the COPY queued as statement i.
+func (p *PGXBatcher) runCopy(ctx context.Context, i int) error {
+	c := p.statements[i].copy
+	res := p.statements[i].result
+
+	n, err := p.conn.(copier).CopyFrom(ctx, c.table, c.columns, c.rows)
+	res.Executed = true
+	res.Err = err
+	if err == nil {
+		res.setCommandTag(pgconn.NewCommandTag(fmt.Sprintf("COPY %d", n)))
+	}
+	return err
+}
+
+func (p *PGXBatcher) isCopy(s step) bool {
+	return len(s.indexes) == 1 && s.sql == "" && p.statements[s.indexes[0]].copy != nil
+}
+
+// supportsCopy reports whether the batch's connection can run a COPY. A connection acquired from a pool can.
+func (p *PGXBatcher) supportsCopy() bool {
+	switch p.conn.(type) {
+	case copier, acquirer:
+		return true
+	}
+	return false
+}
+
+func (p *PGXBatcher) hasCopy() bool {
+	return slices.ContainsFunc(p.statements, func(s statement) bool { return s.copy != nil })
+}
+
+// begin returns the step that begins the batch's transaction, if the batcher has to begin one.
+func (p *PGXBatcher) begin() []step {
+	if !p.transactional || p.inTx {
+		return nil
+	}
+	return append([]step{control(p.beginSQL())}, p.claim()...)
+}
+
+// commit returns the step that commits the batch's transaction, if the batcher has to commit one.
+func (p *PGXBatcher) commit() []step {
+	if !p.transactional || p.inTx {
+		return nil
+	}
+	return []step{control(p.commitSQL())}
+}
+
+// beginSQL returns the statement that begins the batch's transaction according to its pgx.TxOptions.
+func (p *PGXBatcher) beginSQL() string {
+	if p.txOptions.BeginQuery != "" {
+		return p.txOptions.BeginQuery
+	}
+
+	var sb strings.Builder
+	sb.WriteString("BEGIN")
+	if p.txOptions.IsoLevel != "" {
+		sb.WriteString(" ISOLATION LEVEL ")
+		sb.WriteString(strings.ToUpper(string(p.txOptions.IsoLevel)))
+	}
+	if p.txOptions.AccessMode != "" {
+		sb.WriteByte(' ')
+		sb.WriteString(strings.ToUpper(string(p.txOptions.AccessMode)))
+	}
+	if p.txOptions.DeferrableMode != "" {
+		sb.WriteByte(' ')
+		sb.WriteString(strings.ToUpper(string(p.txOptions.DeferrableMode)))
+	}
+	return sb.String()
+}
+
+// commitDeferred commits the batch's transaction if it was not committed along with the last chunk, see deferCommit.
+func (p *PGXBatcher) commitDeferred(ctx context.Context) error {
+	if !p.deferCommit() {
+		return nil
+	}
+	if _, err := p.run(ctx, p.commit()); err != nil {
+		p.rollback(ctx)
+		return err
+	}
+	return nil
+}
+
+func (p *PGXBatcher) commitSQL() string {
+	if p.txOptions.CommitQuery != "" {
+		return p.txOptions.CommitQuery
+	}
+	return "COMMIT"
+}
+
+// rollback ends the transaction that a failed transactional batch leaves open on the connection, so that the
+// connection can be used again, e.g. to retry the batch. A transaction passed to NewInTx is left for the caller to
+// roll back.
+func (p *PGXBatcher) rollback(ctx context.Context) {
+	if !p.transactional || p.inTx {
+		return
+	}
+	_, _ = p.run(ctx, []step{control("ROLLBACK")})
+}
+
+// read reads the result of s from results and records it in the results of its statements.
+func (p *PGXBatcher) read(results pgx.BatchResults, s step) error {
+	switch {
+	case len(s.indexes) == 0:
+		_, err := results.Exec()
+		return err
+	case s.sql == "":
+		i := s.indexes[0]
+		res := p.statements[i].result
+		res.Err = p.batch.QueuedQueries[i].Fn(results)
+		res.Executed = true
+		return res.Err
+	case s.chained:
+		// A chain returns the result of its last statement and succeeds or fails as a whole.
+		last := s.indexes[len(s.indexes)-1]
+		err := p.batch.QueuedQueries[last].Fn(results)
+		for _, i := range s.indexes {
+			res := p.statements[i].result
+			res.Executed = true
+			res.Err = err
+		}
+		return err
+	}
+
+	// A merged statement succeeds or fails as a whole.
+	_, err := results.Exec()
+	for _, i := range s.indexes {
+		res := p.statements[i].result
+		res.Executed = true
+		res.Err = err
+		if err == nil {
+			res.setCommandTag(mergedInsertTag)
+		}
+	}
+	return err
+}
+
+func (p *PGXBatcher) resetResults(s step) {
+	for _, i := range s.indexes {
+		p.statements[i].result.reset()
+	}
+}
+
+// chunks splits steps into chunks that are each sent in a single round trip.
+func (p *PGXBatcher) chunks(steps []step) [][]step {
+	var chunks [][]step
+	for len(steps) > 0 {
+		chunk := p.nextChunk(steps)
+		chunks = append(chunks, chunk)
+		steps = steps[len(chunk):]
+	}
+	return chunks
+}
+
+// nextChunk returns the longest prefix of steps that stays within the batch's round trip limits, counting each of
+// the statements in a merged or chained step. It contains at least one step, even if that step exceeds the limits on
+// its own. A COPY is always a chunk of its own.
+func (p *PGXBatcher) nextChunk(steps []step) []step {
+	if len(steps) > 0 && p.isCopy(steps[0]) {
+		return steps[:1]
+	}
+
+	size, statements := 0, 0
+	for n, s := range steps {
+		if p.isCopy(s) {
+			return steps[:n]
+		}
+		statements += max(len(s.indexes), 1)
+		if p.maxStatements > 0 && statements > p.maxStatements && n > 0 {
+			return steps[:n]
+		}
+		size += p.stepSize(s)
+		if p.maxBytes > 0 && size > p.maxBytes && n > 0 {
+			return steps[:n]
+		}
+	}
+	return steps
+}
+
+// stepSize estimates the number of bytes a step adds to a batch. Arguments other than strings and byte slices are
+// counted as 8 bytes.
+func (p *PGXBatcher) stepSize(s step) int {
+	sql, args := s.sql, s.args
+	if len(s.indexes) == 1 && sql == "" {
+		qq := p.batch.QueuedQueries[s.indexes[0]]
+		sql, args = qq.SQL, qq.Arguments
+	}
+
+	size := len(sql)
+	for _, arg := range args {
+		switch arg := arg.(type) {
+		case string:
+			size += len(arg)
+		case []byte:
+			size += len(arg)
+		default:
+			size += 8
+		}
+	}
+	return size
+}
+
+func (p *PGXBatcher) reportProgress(chunk int, steps []step, completed int, err error) {
+	if p.progress == nil {
+		return
+	}
+
+	var indexes []int
+	for _, s := range steps {
+		indexes = append(indexes, s.indexes...)
+	}
+	p.progress(Progress{
+		Chunk:      chunk + 1,
+		Statements: indexes,
+		Completed:  completed,
+		Total:      len(p.queries),
+		Err:        err,
+	})
+}
+
+// plan returns the steps that execute the queued statements in queue order.
+func (p *PGXBatcher) plan() []step {
+	steps := make([]step, len(p.queries))
+	for i := range steps {
+		steps[i] = step{indexes: []int{i}}
+	}
+	if p.mergeInserts {
+		steps = p.mergeInsertSteps(steps)
+	}
+	return p.chainSteps(steps)
+}
+
+func countStatements(steps []step) int {
+	n := 0
+	for _, s := range steps {
+		n += len(s.indexes)
+	}
+	return n
+}
+
+func (p *PGXBatcher) statementErrors(failures []int) error {
+	if len(failures) == 0 {
+		return nil
+	}
+
+	slices.Sort(failures)
+	errs := make(StatementErrors, len(failures))
+	for j, i := range failures {
+		errs[j] = p.statementError(i)
+	}
+	return errs
+}
+
+func (p *PGXBatcher) statementError(i int) *StatementError {
+	return &StatementError{
+		Index: i,
+		SQL:   p.queries[i],
+		Args:  p.redact(i),
+		Err:   p.statements[i].result.Err,
+	}
+}
+
+// redact returns the arguments of statement i as returned by the batch's Redactor.
+func (p *PGXBatcher) redact(i int) []any {
+	redactor := p.redactor
+	if redactor == nil {
+		redactor = redactArgs
+	}
+	return redactor(p.queries[i], p.batch.QueuedQueries[i].Arguments)
+}
@@ -0,0 +1,50 @@
+package pgxbatcher
+
+import (
+	"slices"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Expectation checks the command tag of a statement queued with QueueExpect. It returns an error if the statement did
+// not have the expected effect.
+type Expectation func(ct pgconn.CommandTag) error
+
+// ExpectRows returns an Expectation that the statement affects exactly n rows. Otherwise it fails with a
+// *RowCountError.
+func ExpectRows(n int64) Expectation {
+	return func(ct pgconn.CommandTag) error {
+		if ct.RowsAffected() != n {
+			return &RowCountError{Expected: n, Actual: ct.RowsAffected()}
+		}
+		return nil
+	}
+}
+
+// QueueExpect adds a statement to the batch whose command tag is checked by expect when the batch is executed. A
+// statement that does not meet its expectation fails with the error returned by expect, e.g. a stale version in
+// "UPDATE t SET ..., version = version + 1 WHERE id = $1 AND version = $2" queued with ExpectRows(1).
+//
+// The check happens once the result has been read, so a transactional batch holding such statements is committed in a
+// separate round trip after all of them have been checked, and rolled back if one of them fails. In a
+// non-transactional batch the statement, and the statements sent in the same round trip, stay applied. In
+// ContinueOnError mode the results of those statements are still read.
+func (p *PGXBatcher) QueueExpect(sql string, expect Expectation, args ...any) *StatementResult {
+	qq, res := p.queue(sql, args)
+	p.statements[res.Index].expect = expect
+	qq.Exec(func(ct pgconn.CommandTag) error {
+		res.setCommandTag(ct)
+		err := expect(ct)
+		res.callbackErr = err != nil
+		return err
+	})
+	return res
+}
+
+// deferCommit reports whether the batch's transaction is committed in a round trip of its own, so that it can be
+// rolled back if a statement does not meet its expectation or a callback reading its rows fails.
+func (p *PGXBatcher) deferCommit() bool {
+	return p.transactional && !p.inTx && slices.ContainsFunc(p.statements, func(s statement) bool {
+		return s.expect != nil || s.rows
+	})
+}
@@ -0,0 +1,76 @@
+package pgxbatcher
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestPGXBatcher_QueueExpect(t *testing.T) {
+	t.Cleanup(func() { truncateUsers(t) })
+
+	var id int
+	err := conn.QueryRow(context.TODO(), "INSERT INTO users (name, email) VALUES ($1, $2) RETURNING id", "Alice", "alice@example.com").Scan(&id)
+	if err != nil {
+		t.Fatalf("Failed to insert user: %v", err)
+	}
+
+	b := New(conn, true)
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Bob", "bob@example.com")
+	updated := b.QueueExpect("UPDATE users SET email = $1 WHERE id = $2", ExpectRows(1), "alice@example.org", id)
+	stale := b.QueueExpect("UPDATE users SET email = $1 WHERE id = $2 AND name = $3", ExpectRows(1), "alice@example.net", id, "Carol")
+
+	err = b.Execute(context.TODO())
+	if !errors.Is(err, ErrUnexpectedRowCount) {
+		t.Fatalf("expected ErrUnexpectedRowCount, got %v", err)
+	}
+	var rowCountErr *RowCountError
+	if !errors.As(err, &rowCountErr) || rowCountErr.Expected != 1 || rowCountErr.Actual != 0 {
+		t.Errorf("expected a RowCountError for 1 and 0 rows, got %v", err)
+	}
+	var stmtErr *StatementError
+	if !errors.As(err, &stmtErr) || stmtErr.Index != stale.Index {
+		t.Errorf("expected statement %d to fail, got %v", stale.Index, err)
+	}
+	if updated.Err != nil || updated.RowsAffected != 1 {
+		t.Errorf("expected statement %d to update one row, got %d (%v)", updated.Index, updated.RowsAffected, updated.Err)
+	}
+
+	var count int
+	err = conn.QueryRow(context.TODO(), "SELECT COUNT(*) FROM users WHERE name = 'Bob' OR email <> 'alice@example.com'").Scan(&count)
+	if err != nil {
+		t.Fatalf("Failed to query test table: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("Expected the batch to be rolled back, got %d changed rows", count)
+	}
+
+	// in a non-transactional batch in ContinueOnError mode a mismatch does not hide the statements after it
+	truncateUsers(t)
+	b = NewWithOptions(conn, WithErrorMode(ContinueOnError))
+	stale = b.QueueExpect("UPDATE users SET email = $1 WHERE name = $2", ExpectRows(1), "carol@example.org", "Carol")
+	inserted := b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Dave", "dave@example.com")
+	checked := b.QueueExpect("UPDATE users SET email = $1 WHERE name = $2", ExpectRows(1), "dave@example.org", "Dave")
+
+	err = b.Execute(context.TODO())
+	var stmtErrs StatementErrors
+	if !errors.As(err, &stmtErrs) || len(stmtErrs) != 1 || !errors.As(stmtErrs[0], &stmtErr) || stmtErr.Index != stale.Index {
+		t.Fatalf("expected statement %d to fail, got %v", stale.Index, err)
+	}
+	if !stale.Executed || !errors.Is(stale.Err, ErrUnexpectedRowCount) {
+		t.Errorf("expected statement %d to fail with ErrUnexpectedRowCount, got executed=%v err=%v", stale.Index, stale.Executed, stale.Err)
+	}
+	for _, res := range []*StatementResult{inserted, checked} {
+		if !res.Executed || res.Err != nil || res.RowsAffected != 1 {
+			t.Errorf("expected statement %d to affect one row, got executed=%v rows=%d err=%v", res.Index, res.Executed, res.RowsAffected, res.Err)
+		}
+	}
+
+	err = conn.QueryRow(context.TODO(), "SELECT COUNT(*) FROM users WHERE email = 'dave@example.org'").Scan(&count)
+	if err != nil {
+		t.Fatalf("Failed to query test table: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected the statements after the mismatch to be applied once, got %d rows", count)
+	}
+}
@@ -0,0 +1,51 @@
+package pgxbatcher
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// log records the outcome of Execute with the batch's logger. Failed statements are logged at error level, one record
+// each, followed by a record for the batch.
+func (p *PGXBatcher) log(ctx context.Context, duration time.Duration, err error) {
+	if p.logger == nil {
+		return
+	}
+
+	for i, s := range p.statements {
+		if s.result.Err == nil {
+			continue
+		}
+		p.logger.LogAttrs(ctx, slog.LevelError, "batch statement failed",
+			slog.Int("index", i),
+			slog.String("sql", p.queries[i]),
+			slog.Any("args", p.redact(i)),
+			errorAttr(s.result.Err),
+		)
+	}
+
+	attrs := []slog.Attr{
+		slog.Int("statements", len(p.queries)),
+		slog.Duration("duration", duration),
+		slog.Bool("transactional", p.transactional),
+	}
+	if err != nil {
+		p.logger.LogAttrs(ctx, slog.LevelError, "batch failed", append(attrs, errorAttr(err))...)
+		return
+	}
+	p.logger.LogAttrs(ctx, slog.LevelInfo, "batch executed", attrs...)
+}
+
+// errorAttr returns the attribute that err is logged with. An error from the server is logged by its SQLSTATE only, as
+// its message and detail can hold argument or row values that the Redactor has no chance to mask.
+func errorAttr(err error) slog.Attr {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return slog.String("code", pgErr.Code)
+	}
+	return slog.Any("error", err)
+}
@@ -0,0 +1,53 @@
+package pgxbatcher
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestPGXBatcher_WithLogger(t *testing.T) {
+	t.Cleanup(func() { truncateUsers(t) })
+
+	var buf bytes.Buffer
+	mask := func(sql string, args []any) []any {
+		masked := make([]any, len(args))
+		for i, arg := range args {
+			if s, ok := arg.(string); ok && strings.Contains(s, "@") {
+				arg = "***"
+			}
+			masked[i] = arg
+		}
+		return masked
+	}
+	b := NewWithOptions(conn,
+		WithLogger(slog.New(slog.NewTextHandler(&buf, nil))),
+		WithRedactor(mask),
+	)
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Alice", "alice@example.com")
+	// fails with a duplicate key
+	b.Queue("INSERT INTO users (id, name, email) SELECT id, $1, $2 FROM users WHERE name = 'Alice'", "Bob", "bob@example.com")
+
+	err := b.Execute(context.TODO())
+	if err == nil {
+		t.Fatal("expected an error, but got none")
+	}
+
+	out := buf.String()
+	for _, want := range []string{"batch statement failed", "index=1", "args=\"[Bob ***]\"", "code=23505", "batch failed", "statements=2", "transactional=false"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected log to contain %q, got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "bob@example.com") || strings.Contains(out, "duplicate key") {
+		t.Errorf("expected email and error message to be redacted, got:\n%s", out)
+	}
+
+	var stmtErr *StatementError
+	if !errors.As(err, &stmtErr) || stmtErr.Args[1] != "***" {
+		t.Errorf("expected redacted args in statement error, got %v", err)
+	}
+}
@@ -0,0 +1,237 @@
+package pgxbatcher
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// marshalMagic starts every batch encoded by MarshalBinary and is followed by the version of the encoding.
+const (
+	marshalMagic   = "PGXB"
+	marshalVersion = 1
+)
+
+// Kinds of encoded arguments.
+const (
+	argNull byte = iota
+	argValue
+	argRef
+)
+
+// MarshalBinary encodes the queued statements and their arguments, e.g. to store them in an outbox or send them to a
+// queue and execute them later. It implements encoding.BinaryMarshaler. Arguments are encoded with the type map of
+// the batch's connection, or pgx's default type map if the connection does not provide one, and are decoded by
+// UnmarshalBinary into the default Go type of their PostgreSQL type, e.g. an int into an int64. Refs are preserved.
+//
+// Only statements queued with Queue can be encoded, as the functions passed to QueueQuery, QueueExpect and QueueCopy
+// cannot. The batch's options, e.g. whether it is transactional, are not encoded either.
+func (p *PGXBatcher) MarshalBinary() ([]byte, error) {
+	if err := p.checkRefs(); err != nil {
+		return nil, err
+	}
+	m := p.typeMap()
+
+	buf := append([]byte(marshalMagic), marshalVersion)
+	buf = binary.AppendUvarint(buf, uint64(len(p.statements)))
+	for i, s := range p.statements {
+		if s.rows || s.expect != nil || s.copy != nil {
+			return nil, fmt.Errorf("statement %d: %w", i, ErrNotMarshalable)
+		}
+
+		sql, args, err := p.rewrite(context.Background(), i)
+		if err != nil {
+			return nil, fmt.Errorf("statement %d: %w", i, err)
+		}
+		buf = appendString(buf, sql)
+		buf = binary.AppendUvarint(buf, uint64(len(args)))
+		for j, arg := range args {
+			buf, err = appendArg(m, buf, arg)
+			if err != nil {
+				return nil, fmt.Errorf("statement %d: argument $%d: %w", i, j+1, err)
+			}
+		}
+	}
+	return buf, nil
+}
+
+// UnmarshalBinary replaces the queued statements with those encoded in data by MarshalBinary. It implements
+// encoding.BinaryUnmarshaler. The batch keeps its options, and the StatementResults returned by Results are new.
+func (p *PGXBatcher) UnmarshalBinary(data []byte) error {
+	m := p.typeMap()
+	r := bytes.NewReader(data)
+
+	header := make([]byte, len(marshalMagic)+1)
+	if _, err := io.ReadFull(r, header); err != nil || string(header[:len(marshalMagic)]) != marshalMagic {
+		return fmt.Errorf("%w: not an encoded batch", ErrInvalidEncoding)
+	}
+	if header[len(marshalMagic)] != marshalVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrInvalidEncoding, header[len(marshalMagic)])
+	}
+
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidEncoding, err)
+	}
+
+	b := NewWithOptions(p.conn)
+	for i := uint64(0); i < n; i++ {
+		sql, err := readString(r)
+		if err != nil {
+			return fmt.Errorf("%w: statement %d: %v", ErrInvalidEncoding, i, err)
+		}
+		nargs, err := binary.ReadUvarint(r)
+		if err != nil || nargs > uint64(r.Len()) {
+			return fmt.Errorf("%w: statement %d: invalid number of arguments", ErrInvalidEncoding, i)
+		}
+		args := make([]any, nargs)
+		for j := range args {
+			args[j], err = readArg(m, r, b.statements)
+			if err != nil {
+				return fmt.Errorf("%w: statement %d: argument $%d: %v", ErrInvalidEncoding, i, j+1, err)
+			}
+		}
+		b.Queue(sql, args...)
+	}
+	if r.Len() > 0 {
+		return fmt.Errorf("%w: unexpected data after the last statement", ErrInvalidEncoding)
+	}
+
+	p.Reset()
+	p.batch, p.queries, p.statements = b.batch, b.queries, b.statements
+	return nil
+}
+
+// typeMap returns the type map of the batch's connection, which knows the types registered on it, or a new map with
+// pgx's default types.
+func (p *PGXBatcher) typeMap() *pgtype.Map {
+	if conn, ok := pipelineConn(p.conn); ok && conn != nil {
+		return conn.TypeMap()
+	}
+	return pgtype.NewMap()
+}
+
+// appendArg appends arg to buf. Values are encoded as the PostgreSQL type that m associates with their Go type, in its
+// preferred format.
+func appendArg(m *pgtype.Map, buf []byte, arg any) ([]byte, error) {
+	switch arg := arg.(type) {
+	case nil:
+		return append(buf, argNull), nil
+	case Ref:
+		buf = append(buf, argRef)
+		buf = binary.AppendUvarint(buf, uint64(arg.result.Index))
+		return appendString(buf, arg.column), nil
+	case driver.Valuer:
+		if v := reflect.ValueOf(arg); v.Kind() == reflect.Pointer && v.IsNil() {
+			return append(buf, argNull), nil
+		}
+		if _, ok := m.TypeForValue(arg); !ok {
+			v, err := arg.Value()
+			if err != nil {
+				return nil, err
+			}
+			return appendArg(m, buf, v)
+		}
+	}
+
+	typ, ok := m.TypeForValue(arg)
+	if !ok {
+		if v := reflect.ValueOf(arg); v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return append(buf, argNull), nil
+			}
+			return appendArg(m, buf, v.Elem().Interface())
+		}
+		return nil, fmt.Errorf("%w: no PostgreSQL type for %T", ErrNotMarshalable, arg)
+	}
+
+	format := m.FormatCodeForOID(typ.OID)
+	data, err := m.Encode(typ.OID, format, arg, nil)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return append(buf, argNull), nil
+	}
+
+	buf = append(buf, argValue)
+	buf = binary.AppendUvarint(buf, uint64(typ.OID))
+	buf = append(buf, byte(format))
+	buf = binary.AppendUvarint(buf, uint64(len(data)))
+	return append(buf, data...), nil
+}
+
+// readArg reads an argument written by appendArg. Refs are resolved against the statements decoded so far.
+func readArg(m *pgtype.Map, r *bytes.Reader, statements []statement) (any, error) {
+	kind, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case argNull:
+		return nil, nil
+	case argRef:
+		index, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		column, err := readString(r)
+		if err != nil {
+			return nil, err
+		}
+		if index >= uint64(len(statements)) {
+			return nil, fmt.Errorf("reference to statement %d", index)
+		}
+		return statements[index].result.Ref(column), nil
+	case argValue:
+		oid, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		format, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		data, err := readBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		typ, ok := m.TypeForOID(uint32(oid))
+		if !ok {
+			return nil, fmt.Errorf("unknown type OID %d", oid)
+		}
+		return typ.Codec.DecodeValue(m, uint32(oid), int16(format), data)
+	}
+	return nil, fmt.Errorf("unknown argument kind %d", kind)
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+func readString(r *bytes.Reader) (string, error) {
+	b, err := readBytes(r)
+	return string(b), err
+}
+
+func readBytes(r *bytes.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(r.Len()) {
+		return nil, errors.New("unexpected end of data")
+	}
+	b := make([]byte, n)
+	_, err = io.ReadFull(r, b)
+	return b, err
+}
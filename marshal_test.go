@@ -0,0 +1,95 @@
+package pgxbatcher
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestPGXBatcher_MarshalBinary(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	name := "Bob"
+
+	b := New(conn, true)
+	parent := b.Queue("INSERT INTO users (name, email) VALUES ($1, $2) RETURNING id", "Alice", nil)
+	b.Queue("UPDATE users SET email = $1 WHERE id = $2 AND created < $3", []byte{0xde, 0xad}, parent.Ref("id"), created)
+	b.Queue("SELECT @name::text, @n::int", pgx.NamedArgs{"name": &name, "n": 42})
+	b.Queue("SELECT $1::int[], $2, $3", []int32{1, 2}, 1.5, true)
+
+	data, err := b.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	replay := New(conn, true)
+	replay.Queue("SELECT 1")
+	if err := replay.UnmarshalBinary(data); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	wantSQL := []string{b.queries[0], b.queries[1], "SELECT $1::text, $2::int", b.queries[3]}
+	if !reflect.DeepEqual(replay.queries, wantSQL) {
+		t.Errorf("expected statements %q, got %q", wantSQL, replay.queries)
+	}
+	wantArgs := [][]any{
+		{"Alice", nil},
+		{[]byte{0xde, 0xad}, replay.statements[0].result.Ref("id"), created},
+		{"Bob", int64(42)},
+		{[]any{int32(1), int32(2)}, 1.5, true},
+	}
+	for i, want := range wantArgs {
+		got := replay.batch.QueuedQueries[i].Arguments
+		if len(got) != len(want) {
+			t.Errorf("statement %d: expected arguments %v, got %v", i, want, got)
+			continue
+		}
+		for j := range want {
+			if tm, ok := got[j].(time.Time); ok {
+				got[j] = tm.UTC()
+			}
+			if !reflect.DeepEqual(got[j], want[j]) {
+				t.Errorf("statement %d: expected argument %d to be %#v, got %#v", i, j+1, want[j], got[j])
+			}
+		}
+	}
+
+	if err := replay.UnmarshalBinary(data[:len(data)-1]); !errors.Is(err, ErrInvalidEncoding) {
+		t.Errorf("expected ErrInvalidEncoding for truncated data, got %v", err)
+	}
+
+	b.QueueQueryRow("SELECT 1", nil, new(int))
+	if _, err := b.MarshalBinary(); !errors.Is(err, ErrNotMarshalable) {
+		t.Errorf("expected ErrNotMarshalable for a statement returning rows, got %v", err)
+	}
+}
+
+func TestPGXBatcher_UnmarshalBinary_Execute(t *testing.T) {
+	t.Cleanup(func() { truncateUsers(t) })
+
+	b := New(conn, true)
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Alice", "alice@example.com")
+	data, err := b.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	replay := New(conn, true)
+	if err := replay.UnmarshalBinary(data); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := replay.Execute(context.TODO()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var count int
+	if err := conn.QueryRow(context.TODO(), "SELECT COUNT(*) FROM users WHERE name = 'Alice'").Scan(&count); err != nil {
+		t.Fatalf("Failed to query test table: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 row in test table, got %d", count)
+	}
+}
@@ -0,0 +1,117 @@
+package pgxbatcher
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// maxBindParameters is the maximum number of bind parameters PostgreSQL accepts in a single statement.
+const maxBindParameters = 65535
+
+// insertValues matches a single-row INSERT with a column list whose VALUES are all placeholders.
+var insertValues = regexp.MustCompile(`(?is)^\s*(insert\s+into\s+.+?\([^()]*\)\s*values)\s*\(\s*(\$\d+(?:\s*,\s*\$\d+)*)\s*\)\s*;?\s*$`)
+
+// mergedInsertTag is the command tag recorded for each statement of a merged INSERT.
+var mergedInsertTag = pgconn.NewCommandTag("INSERT 0 1")
+
+// insertTemplate returns the part of sql up to and including VALUES and the number of values if sql is a single-row
+// INSERT whose values are exactly the placeholders $1 to $n in order.
+func insertTemplate(sql string) (string, int, bool) {
+	m := insertValues.FindStringSubmatch(sql)
+	if m == nil {
+		return "", 0, false
+	}
+
+	placeholders := strings.Split(m[2], ",")
+	for j, ph := range placeholders {
+		if strings.TrimSpace(ph) != "$"+strconv.Itoa(j+1) {
+			return "", 0, false
+		}
+	}
+	return m[1], len(placeholders), true
+}
+
+// mergeInsertSteps merges runs of consecutive steps that execute the same single-row INSERT into multi-row INSERTs.
+// Only statements queued with Queue are merged, and each merged statement stays within maxBindParameters.
+func (p *PGXBatcher) mergeInsertSteps(steps []step) []step {
+	var merged []step
+	for len(steps) > 0 {
+		i := steps[0].indexes[0]
+		prefix, n, ok := p.mergeableInsert(i)
+		if !ok {
+			merged = append(merged, steps[0])
+			steps = steps[1:]
+			continue
+		}
+
+		run := 1
+		for run < len(steps) && (run+1)*n <= maxBindParameters && p.queries[steps[run].indexes[0]] == p.queries[i] {
+			if _, _, ok := p.mergeableInsert(steps[run].indexes[0]); !ok {
+				break
+			}
+			run++
+		}
+
+		if run == 1 {
+			merged = append(merged, steps[0])
+		} else {
+			merged = append(merged, p.mergeInsert(prefix, n, steps[:run]))
+		}
+		steps = steps[run:]
+	}
+	return merged
+}
+
+func (p *PGXBatcher) mergeableInsert(i int) (string, int, bool) {
+	if s := p.statements[i]; s.rows || s.expect != nil || s.refs || s.referenced {
+		return "", 0, false
+	}
+
+	args := p.batch.QueuedQueries[i].Arguments
+	if len(args) > 0 {
+		if _, ok := args[0].(pgx.QueryRewriter); ok {
+			return "", 0, false
+		}
+	}
+
+	prefix, n, ok := insertTemplate(p.queries[i])
+	if !ok || n != len(args) {
+		return "", 0, false
+	}
+	return prefix, n, true
+}
+
+// mergeInsert builds a multi-row INSERT executing steps, which all execute the same INSERT with n values.
+func (p *PGXBatcher) mergeInsert(prefix string, n int, steps []step) step {
+	merged := step{
+		indexes: make([]int, 0, len(steps)),
+		args:    make([]any, 0, len(steps)*n),
+	}
+
+	var sb strings.Builder
+	sb.WriteString(prefix)
+	for r, s := range steps {
+		if r > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(" (")
+		for j := 0; j < n; j++ {
+			if j > 0 {
+				sb.WriteString(", ")
+			}
+			sb.WriteByte('$')
+			sb.WriteString(strconv.Itoa(r*n + j + 1))
+		}
+		sb.WriteByte(')')
+
+		i := s.indexes[0]
+		merged.indexes = append(merged.indexes, i)
+		merged.args = append(merged.args, p.batch.QueuedQueries[i].Arguments...)
+	}
+	merged.sql = sb.String()
+	return merged
+}
@@ -0,0 +1,90 @@
+package pgxbatcher
+
+import (
+	"context"
+	"testing"
+)
+
+func TestInsertTemplate(t *testing.T) {
+	tests := []struct {
+		sql    string
+		prefix string
+		n      int
+		ok     bool
+	}{
+		{"INSERT INTO users (name, email) VALUES ($1, $2)", "INSERT INTO users (name, email) VALUES", 2, true},
+		{"  insert into public.users(name) values($1);", "insert into public.users(name) values", 1, true},
+		{"INSERT INTO users (name, email) VALUES ($2, $1)", "", 0, false},
+		{"INSERT INTO users (name, email) VALUES ($1, now())", "", 0, false},
+		{"INSERT INTO users (name, email) VALUES ($1, $2) RETURNING id", "", 0, false},
+		{"INSERT INTO users (name, email) VALUES ($1, $2) ON CONFLICT DO NOTHING", "", 0, false},
+		{"INSERT INTO users VALUES ($1, $2)", "", 0, false},
+		{"UPDATE users SET name = $1", "", 0, false},
+	}
+
+	for _, tt := range tests {
+		prefix, n, ok := insertTemplate(tt.sql)
+		if prefix != tt.prefix || n != tt.n || ok != tt.ok {
+			t.Errorf("insertTemplate(%q) = %q, %d, %v, want %q, %d, %v", tt.sql, prefix, n, ok, tt.prefix, tt.n, tt.ok)
+		}
+	}
+}
+
+func TestPGXBatcher_WithMergedInserts(t *testing.T) {
+	t.Cleanup(func() { truncateUsers(t) })
+
+	var statements []int
+	b := NewWithOptions(conn, WithTransactional(true), WithMergedInserts(), WithProgress(func(p Progress) {
+		statements = p.Statements
+	}))
+	for _, name := range []string{"Alice", "Bob", "Carol"} {
+		b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", name, name+"@example.com")
+	}
+	b.Queue("UPDATE users SET email = upper(email)")
+	dave := b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Dave", "dave@example.com")
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Erin", "erin@example.com")
+
+	err := b.Execute(context.TODO())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(statements) != 6 {
+		t.Errorf("Expected progress for 6 statements, got %v", statements)
+	}
+	for _, res := range b.Results() {
+		if !res.Executed || res.Err != nil {
+			t.Errorf("unexpected result for statement %d: executed=%v err=%v", res.Index, res.Executed, res.Err)
+		}
+	}
+	if dave.RowsAffected != 1 || !dave.CommandTag.Insert() {
+		t.Errorf("Expected INSERT of 1 row, got %q", dave.CommandTag)
+	}
+
+	var upper, lower int
+	err = conn.QueryRow(context.TODO(), "SELECT COUNT(*) FILTER (WHERE email = upper(email)), COUNT(*) FILTER (WHERE email = lower(email)) FROM users").Scan(&upper, &lower)
+	if err != nil {
+		t.Fatalf("Failed to query test table: %v", err)
+	}
+	if upper != 3 || lower != 2 {
+		t.Errorf("Expected 3 upper and 2 lower case emails, got %d and %d", upper, lower)
+	}
+}
+
+func TestPGXBatcher_WithMergedInserts_Chunks(t *testing.T) {
+	b := NewWithOptions(nil, WithMergedInserts(), WithMaxStatementsPerRoundTrip(2))
+	b.Queue("SELECT 1")
+	for _, name := range []string{"Alice", "Bob", "Carol"} {
+		b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", name, name+"@example.com")
+	}
+	b.Queue("SELECT 2")
+	b.Queue("SELECT 3")
+
+	// the merged INSERT counts as three statements, so it is sent on its own
+	var sizes []int
+	for _, chunk := range b.chunks(b.plan()) {
+		sizes = append(sizes, countStatements(chunk))
+	}
+	if len(sizes) != 3 || sizes[0] != 1 || sizes[1] != 3 || sizes[2] != 2 {
+		t.Errorf("expected chunks of 1, 3 and 2 statements, got %v", sizes)
+	}
+}
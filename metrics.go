@@ -0,0 +1,142 @@
+package pgxbatcher
+
+import (
+	"errors"
+	"expvar"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Metrics receives measurements of executed batches. It is set with WithMetrics. Implementations must be safe for
+// concurrent use, as a Metrics is typically shared by many batches.
+type Metrics interface {
+	// ObserveBatch is called at the end of Execute with the number of statements in the batch, how long Execute took
+	// and its error, if any.
+	ObserveBatch(size int, duration time.Duration, err error)
+	// ObserveStatement is called at the end of Execute for each statement that was executed, with its index, command
+	// tag and error, if any.
+	ObserveStatement(index int, commandTag pgconn.CommandTag, err error)
+}
+
+// errorCode returns the SQLSTATE of err, or "unknown" if err did not come from the server.
+func errorCode(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code
+	}
+	return "unknown"
+}
+
+// MetricsSnapshot holds the measurements recorded by MemoryMetrics.
+type MetricsSnapshot struct {
+	Batches       int64
+	FailedBatches int64
+	// BatchStatements is the total number of statements in all batches.
+	BatchStatements int64
+	// BatchDuration is the total duration of all batches.
+	BatchDuration    time.Duration
+	Statements       int64
+	FailedStatements int64
+	// Errors counts the failed statements by SQLSTATE. Errors that did not come from the server are counted as
+	// "unknown".
+	Errors map[string]int64
+	// BatchErrors counts the failed batches by the SQLSTATE of their error, which also covers failures that belong
+	// to no statement, such as a failed COMMIT. Errors that did not come from the server are counted as "unknown".
+	BatchErrors map[string]int64
+}
+
+// MemoryMetrics is a Metrics that keeps its measurements in memory.
+type MemoryMetrics struct {
+	mu       sync.Mutex
+	snapshot MetricsSnapshot
+}
+
+func (m *MemoryMetrics) ObserveBatch(size int, duration time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.snapshot.Batches++
+	m.snapshot.BatchStatements += int64(size)
+	m.snapshot.BatchDuration += duration
+	if err != nil {
+		m.snapshot.FailedBatches++
+		if m.snapshot.BatchErrors == nil {
+			m.snapshot.BatchErrors = map[string]int64{}
+		}
+		m.snapshot.BatchErrors[errorCode(err)]++
+	}
+}
+
+func (m *MemoryMetrics) ObserveStatement(_ int, _ pgconn.CommandTag, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.snapshot.Statements++
+	if err != nil {
+		m.snapshot.FailedStatements++
+		if m.snapshot.Errors == nil {
+			m.snapshot.Errors = map[string]int64{}
+		}
+		m.snapshot.Errors[errorCode(err)]++
+	}
+}
+
+// Snapshot returns a copy of the measurements recorded so far.
+func (m *MemoryMetrics) Snapshot() MetricsSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.snapshot
+	s.Errors = maps.Clone(s.Errors)
+	s.BatchErrors = maps.Clone(s.BatchErrors)
+	return s
+}
+
+// ExpvarMetrics is a Metrics that publishes its measurements as an expvar.Map with the keys batches, failed_batches,
+// batch_statements, batch_duration_ns, statements, failed_statements, errors, which maps SQLSTATEs to the number of
+// statements that failed with them, and batch_errors, which maps SQLSTATEs to the number of batches that failed with
+// them.
+type ExpvarMetrics struct {
+	vars *expvar.Map
+}
+
+// NewExpvarMetrics creates an ExpvarMetrics published under name. Like expvar.Publish, it panics if name is already
+// in use.
+func NewExpvarMetrics(name string) *ExpvarMetrics {
+	vars := expvar.NewMap(name)
+	vars.Set("errors", new(expvar.Map))
+	vars.Set("batch_errors", new(expvar.Map))
+	return &ExpvarMetrics{vars: vars}
+}
+
+func (m *ExpvarMetrics) ObserveBatch(size int, duration time.Duration, err error) {
+	m.vars.Add("batches", 1)
+	m.vars.Add("batch_statements", int64(size))
+	m.vars.Add("batch_duration_ns", duration.Nanoseconds())
+	if err != nil {
+		m.vars.Add("failed_batches", 1)
+		m.vars.Get("batch_errors").(*expvar.Map).Add(errorCode(err), 1)
+	}
+}
+
+func (m *ExpvarMetrics) ObserveStatement(_ int, _ pgconn.CommandTag, err error) {
+	m.vars.Add("statements", 1)
+	if err != nil {
+		m.vars.Add("failed_statements", 1)
+		m.vars.Get("errors").(*expvar.Map).Add(errorCode(err), 1)
+	}
+}
+
+// observe reports the outcome of Execute to the batch's metrics.
+func (p *PGXBatcher) observe(duration time.Duration, err error) {
+	if p.metrics == nil {
+		return
+	}
+
+	for i, s := range p.statements {
+		if s.result.Executed {
+			p.metrics.ObserveStatement(i, s.result.CommandTag, s.result.Err)
+		}
+	}
+	p.metrics.ObserveBatch(len(p.queries), duration, err)
+}
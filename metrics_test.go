@@ -0,0 +1,60 @@
+package pgxbatcher
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestPGXBatcher_WithMetrics(t *testing.T) {
+	t.Cleanup(func() { truncateUsers(t) })
+
+	metrics := &MemoryMetrics{}
+	b := NewWithOptions(conn, WithErrorMode(ContinueOnError), WithMetrics(metrics))
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Alice", "alice@example.com")
+	b.Queue("SELECT $1::int / 0", 5)
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Bob", "bob@example.com")
+
+	if err := b.Execute(context.TODO()); err == nil {
+		t.Fatal("expected an error, but got none")
+	}
+
+	s := metrics.Snapshot()
+	if s.Batches != 1 || s.FailedBatches != 1 || s.BatchStatements != 3 || s.BatchDuration <= 0 {
+		t.Errorf("unexpected batch metrics: %+v", s)
+	}
+	if s.Statements != 3 || s.FailedStatements != 1 || s.Errors["22012"] != 1 {
+		t.Errorf("unexpected statement metrics: %+v", s)
+	}
+	if s.BatchErrors["22012"] != 1 {
+		t.Errorf("unexpected batch errors: %+v", s.BatchErrors)
+	}
+}
+
+func TestExpvarMetrics(t *testing.T) {
+	m := NewExpvarMetrics("pgxbatcher_test")
+	m.ObserveStatement(0, pgconn.NewCommandTag("INSERT 0 1"), nil)
+	m.ObserveStatement(1, pgconn.CommandTag{}, &pgconn.PgError{Code: "23505"})
+	m.ObserveStatement(2, pgconn.CommandTag{}, errors.New("conn closed"))
+	m.ObserveBatch(3, time.Second, errors.New("batch failed"))
+
+	vars := expvar.Get("pgxbatcher_test").(*expvar.Map)
+	for key, want := range map[string]string{
+		"batches":           "1",
+		"failed_batches":    "1",
+		"batch_statements":  "3",
+		"batch_duration_ns": "1000000000",
+		"statements":        "3",
+		"failed_statements": "2",
+		"errors":            `{"23505": 1, "unknown": 1}`,
+		"batch_errors":      `{"unknown": 1}`,
+	} {
+		if got := vars.Get(key).String(); got != want {
+			t.Errorf("expected %s to be %s, got %s", key, want, got)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package pgxbatcher
+
+import (
+	"log/slog"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Option configures a PGXBatcher created with NewWithOptions.
+type Option func(*PGXBatcher)
+
+// WithTransactional sets whether the batch is executed within a transaction.
+func WithTransactional(transactional bool) Option {
+	return func(p *PGXBatcher) {
+		p.transactional = transactional
+	}
+}
+
+// WithTxOptions sets the options used to begin the batch's transaction, e.g. its isolation level, and makes the batch
+// transactional.
+func WithTxOptions(opts pgx.TxOptions) Option {
+	return func(p *PGXBatcher) {
+		p.transactional = true
+		p.txOptions = opts
+	}
+}
+
+// WithErrorMode sets how Execute handles failing statements.
+func WithErrorMode(mode ErrorMode) Option {
+	return func(p *PGXBatcher) {
+		p.errorMode = mode
+	}
+}
+
+// WithRetryPolicy sets the policy used to replay a transactional batch that fails with a transient error such as a
+// serialization failure or a deadlock.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(p *PGXBatcher) {
+		p.retryPolicy = policy
+	}
+}
+
+// WithMaxStatementsPerRoundTrip limits the number of statements sent in a single round trip. Larger batches are split
+// into chunks that are sent one after another. In a transactional batch every chunk runs inside the same transaction,
+// otherwise each chunk is executed on its own. Statements merged by WithMergedInserts or chained by refs count
+// individually but are never split, so such a group of more than n statements is sent in a round trip of its own.
+func WithMaxStatementsPerRoundTrip(n int) Option {
+	return func(p *PGXBatcher) {
+		p.maxStatements = n
+	}
+}
+
+// WithMaxBytesPerRoundTrip limits the estimated size of the SQL and arguments sent in a single round trip. Larger
+// batches are split into chunks as with WithMaxStatementsPerRoundTrip.
+func WithMaxBytesPerRoundTrip(n int) Option {
+	return func(p *PGXBatcher) {
+		p.maxBytes = n
+	}
+}
+
+// WithProgress sets a function that is called after each chunk of the batch has been sent.
+func WithProgress(fn func(Progress)) Option {
+	return func(p *PGXBatcher) {
+		p.progress = fn
+	}
+}
+
+// WithMergedInserts enables merging consecutive identical single-row INSERTs such as
+// "INSERT INTO t (a, b) VALUES ($1, $2)" into multi-row INSERTs. A merged INSERT succeeds or fails as a whole, so if
+// it fails the error is reported for each of its statements.
+func WithMergedInserts() Option {
+	return func(p *PGXBatcher) {
+		p.mergeInserts = true
+	}
+}
+
+// WithConcurrentChunks sends up to n chunks of a non-transactional batch at a time, each on its own connection, when
+// the batch is executed on a pool, see BatchSender. Statements in different chunks may then run in any order, and the
+// progress function is called in the order in which chunks complete. It has no effect on transactional batches, which
+// run on a single connection.
+func WithConcurrentChunks(n int) Option {
+	return func(p *PGXBatcher) {
+		p.concurrentChunks = n
+	}
+}
+
+// WithPipeline executes the batch in pipeline mode with pgconn.Pipeline instead of pgx.Batch. Each chunk, as limited
+// by WithMaxStatementsPerRoundTrip and WithMaxBytesPerRoundTrip, is sent followed by a sync point and its results
+// are read while the next chunk is being sent, so only two chunks are held in memory at a time. Without these limits
+// the whole batch is a single chunk.
+//
+// In a non-transactional batch every chunk commits on its own, and in ContinueOnError mode every statement does. In
+// StopOnError mode no further chunks are sent once a chunk has failed, but the chunk already sent after it is still
+// executed. Transactional batches in ContinueOnError mode and batches containing a COPY are executed without a
+// pipeline. The connection must be a *pgx.Conn, a pgx.Tx or a pool, see BatchSender, and WithConcurrentChunks has no
+// effect.
+//
+// The statements are described before they are sent. In a batch created with NewInTx a statement that fails to be
+// described aborts the caller's transaction, which must then be rolled back.
+func WithPipeline() Option {
+	return func(p *PGXBatcher) {
+		p.pipeline = true
+	}
+}
+
+// WithTracer sets a Tracer that is called as the batch is executed.
+func WithTracer(t Tracer) Option {
+	return func(p *PGXBatcher) {
+		p.tracer = t
+	}
+}
+
+// WithLogger sets a logger that records the outcome of each Execute: the size of the batch, how long it took, whether
+// it was transactional and the error, if any. Each failed statement is logged with its SQL and its arguments as
+// returned by the batch's Redactor. Errors from the server are logged by their SQLSTATE only, as their messages can
+// hold values.
+func WithLogger(logger *slog.Logger) Option {
+	return func(p *PGXBatcher) {
+		p.logger = logger
+	}
+}
+
+// WithRedactor sets the Redactor applied to statement arguments before they are logged or included in a
+// StatementError. By default each argument is replaced by its type.
+func WithRedactor(r Redactor) Option {
+	return func(p *PGXBatcher) {
+		p.redactor = r
+	}
+}
+
+// WithMetrics sets a Metrics that receives the size, duration and outcome of the batch and of each of its statements.
+func WithMetrics(m Metrics) Option {
+	return func(p *PGXBatcher) {
+		p.metrics = m
+	}
+}
@@ -21,6 +21,10 @@
 //
 //	The second parameter to New() is a boolean flag that specifies whether to execute the batch within a transaction. If set to true, the batch will be executed within a transaction, otherwise each statement will be executed independently.
 //
+//	Further behaviour is configured by creating the batcher with NewWithOptions() instead, for example to set the transaction's isolation level:
+//
+//	batcher := pgxbatcher.NewWithOptions(conn, pgxbatcher.WithTxOptions(pgx.TxOptions{IsoLevel: pgx.Serializable}))
+//
 // 4. Add SQL statements to the batch:
 //
 //	batcher.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", []interface{}{"Alice", "alice@example.com"})
@@ -28,6 +32,17 @@
 //
 //	You can add as many SQL statements as you need to the batch using the Queue() method. The first argument is the SQL statement, and the second argument is a slice of interface{} values containing the query parameters.
 //
+//	Queue() returns a *StatementResult which is populated once the batch has been executed:
+//
+//	res := batcher.Queue("UPDATE users SET active = false WHERE last_login < $1", cutoff)
+//	// after Execute()
+//	fmt.Println(res.RowsAffected)
+//
+//	Rows returned by a statement, for example by an INSERT ... RETURNING, can be scanned into Go values with QueueQueryRow() and QueueQuery():
+//
+//	var id int
+//	batcher.QueueQueryRow("INSERT INTO users (name) VALUES ($1) RETURNING id", []any{"Alice"}, &id)
+//
 // 5. Execute the batch:
 //
 //	err := pgxbatcher.Execute(context.Background())
@@ -35,7 +50,7 @@
 //	    // handle error
 //	}
 //
-//	The Execute() method sends the batch to the database for execution. If the batch was created with a transaction, the transaction will be committed after all statements have been executed. If any errors occur during execution, they will be returned as a BatcherErrors value.
+//	The Execute() method sends the batch to the database for execution. If the batch was created with a transaction, the transaction will be committed after all statements have been executed. If a statement fails, a StatementErrors value is returned holding a *StatementError that identifies the statement by its index and SQL and wraps the underlying *pgconn.PgError, which can still be retrieved with errors.As.
 //
 //	If you don't need to use a transaction, you can create the PGXBatcher object with the transactional flag set to false and each statement in the batch will be executed independently.
 //
@@ -44,65 +59,246 @@ package pgxbatcher
 
 import (
 	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-type batcher interface {
+// BatchSender sends a batch of statements to the database. It is implemented by *pgx.Conn, pgx.Tx and
+// *pgxpool.Pool.
+//
+// A batch may take several round trips, e.g. when it is split into chunks, a COPY is queued or a transactional batch
+// is committed or rolled back on its own, and all of them must reach the same connection. A pool hands out a
+// different connection for every SendBatch, so the batcher acquires one for the whole batch from any BatchSender with
+// an Acquire method like that of *pgxpool.Pool. A type wrapping a pool must therefore expose the pool's Acquire
+// method, or the round trips of a batch may be spread over several connections.
+type BatchSender interface {
 	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
 }
 
+// acquirer is implemented by *pgxpool.Pool and by types wrapping a pool that expose its Acquire method.
+type acquirer interface {
+	Acquire(ctx context.Context) (*pgxpool.Conn, error)
+}
+
+// copier is implemented by connections that can run a COPY queued with QueueCopy.
+type copier interface {
+	CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error)
+}
+
 type PGXBatcher struct {
-	conn          batcher
-	queries       []string
-	batch         *pgx.Batch
-	transactional bool
-	executed      bool
+	conn             BatchSender
+	queries          []string
+	statements       []statement
+	batch            *pgx.Batch
+	transactional    bool
+	txOptions        pgx.TxOptions
+	errorMode        ErrorMode
+	retryPolicy      RetryPolicy
+	maxStatements    int
+	maxBytes         int
+	progress         func(Progress)
+	mergeInserts     bool
+	concurrentChunks int
+	pipeline         bool
+	tracer           Tracer
+	logger           *slog.Logger
+	redactor         Redactor
+	metrics          Metrics
+	spool            *Spool
+	idempotencyKey   string
+	idempotencyTable pgx.Identifier
+	inTx             bool
+	executed         bool
 }
 
-func New(conn batcher, transactional bool) *PGXBatcher {
-	b := pgx.Batch{}
+// statement holds what the batcher knows about a queued statement besides its SQL and arguments, which are kept in
+// queries and batch.
+type statement struct {
+	result *StatementResult
+	// rows reports whether the statement's rows are read by a callback.
+	rows bool
+	// copy is set for a COPY queued with QueueCopy.
+	copy *copyFrom
+	// expect is set for a statement queued with QueueExpect.
+	expect Expectation
+	// refs reports whether the statement has Refs among its arguments, and referenced whether a later statement
+	// refers to it.
+	refs       bool
+	referenced bool
+}
 
-	if transactional {
-		b.Queue("BEGIN")
-	}
-	return &PGXBatcher{
-		conn:          conn,
-		batch:         &b,
-		transactional: transactional,
-	}
+// copyFrom is a COPY FROM queued with QueueCopy.
+type copyFrom struct {
+	table   pgx.Identifier
+	columns []string
+	rows    pgx.CopyFromSource
 }
 
-func (p *PGXBatcher) Queue(sql string, args ...any) {
-	p.batch.Queue(sql, args...)
-	p.queries = append(p.queries, sql)
+// ErrorMode controls how Execute handles failing statements.
+type ErrorMode int
+
+const (
+	// StopOnError stops the batch at the first failing statement. This is the default.
+	StopOnError ErrorMode = iota
+	// ContinueOnError attempts every statement and reports all failures in StatementErrors. In a transactional batch
+	// each statement is wrapped in a savepoint which is rolled back if the statement fails, so the statements that
+	// succeed are still committed.
+	ContinueOnError
+)
+
+// StatementResult describes the outcome of a single queued statement. It is returned by Queue and filled in by
+// Execute once the batch has been sent.
+type StatementResult struct {
+	// Index is the position of the statement in the batch, starting at zero.
+	Index int
+	// CommandTag is the command tag returned by the server, e.g. "UPDATE 3".
+	CommandTag pgconn.CommandTag
+	// RowsAffected is the number of rows reported by CommandTag.
+	RowsAffected int64
+	// Err is the error returned for the statement, if any.
+	Err error
+	// Executed reports whether a result was read back for the statement.
+	Executed bool
+
+	// callbackErr is set if Err was returned by a callback, such as the function passed to QueueQuery or an
+	// Expectation, for a result that the server returned without error.
+	callbackErr bool
 }
 
-func (p *PGXBatcher) Execute(ctx context.Context) error {
-	if len(p.queries) < 1 {
-		return ErrEmptyBatch
-	}
-	if p.executed {
-		return ErrExecutedBatch
+// Progress describes a chunk of a batch that has been sent to the database. A batch is split into chunks when it
+// exceeds the limits set with WithMaxStatementsPerRoundTrip or WithMaxBytesPerRoundTrip.
+type Progress struct {
+	// Chunk is the number of the chunk, starting at one.
+	Chunk int
+	// Statements are the indexes of the statements in the chunk.
+	Statements []int
+	// Completed is the number of statements that have been attempted so far, including those in the chunk.
+	Completed int
+	// Total is the number of statements in the batch.
+	Total int
+	// Err is the error of the chunk's statements, if any.
+	Err error
+}
+
+func (r *StatementResult) setCommandTag(ct pgconn.CommandTag) error {
+	r.CommandTag = ct
+	r.RowsAffected = ct.RowsAffected()
+	return nil
+}
+
+func (r *StatementResult) reset() {
+	*r = StatementResult{Index: r.Index}
+}
+
+func New(conn BatchSender, transactional bool) *PGXBatcher {
+	return NewWithOptions(conn, WithTransactional(transactional))
+}
+
+// NewWithOptions creates a PGXBatcher configured by opts. Without options the batch is not transactional.
+func NewWithOptions(conn BatchSender, opts ...Option) *PGXBatcher {
+	p := &PGXBatcher{
+		conn:  conn,
+		batch: &pgx.Batch{},
 	}
-	if p.transactional {
-		p.batch.Queue("COMMIT")
+	for _, opt := range opts {
+		opt(p)
 	}
+	return p
+}
+
+// NewInTx creates a PGXBatcher that executes its statements within tx. No BEGIN or COMMIT is sent: committing or
+// rolling back tx, also after a failed Execute, is left to the caller. Statements run in ContinueOnError mode are
+// wrapped in savepoints within tx, and the batch is never retried as that would require replaying tx. The
+// WithTransactional and WithTxOptions options have no effect.
+func NewInTx(tx pgx.Tx, opts ...Option) *PGXBatcher {
+	p := NewWithOptions(tx, opts...)
+	p.transactional = true
+	p.inTx = true
+	return p
+}
 
-	results := p.conn.SendBatch(ctx, p.batch)
-	defer results.Close()
-	p.executed = true
+// Queue adds a statement to the batch and returns a handle to its result, which is populated by Execute.
+func (p *PGXBatcher) Queue(sql string, args ...any) *StatementResult {
+	qq, res := p.queue(sql, args)
+	qq.Exec(res.setCommandTag)
+	return res
+}
 
-	for i := 0; i < p.batch.Len(); i++ {
-		_, err := results.Query()
+// QueueQuery adds a statement to the batch whose rows are passed to fn when the batch is executed. fn does not need
+// to close rows. As with QueueExpect, a transactional batch holding such statements is committed in a separate round
+// trip once all of their rows have been read, and rolled back if fn returns an error.
+func (p *PGXBatcher) QueueQuery(sql string, args []any, fn func(rows pgx.Rows) error) *StatementResult {
+	qq, res := p.queue(sql, args)
+	p.statements[res.Index].rows = true
+	qq.Query(func(rows pgx.Rows) error {
+		err := fn(rows)
+		rows.Close()
+		res.setCommandTag(rows.CommandTag())
 		if err != nil {
+			res.callbackErr = rows.Err() == nil
 			return err
 		}
+		return rows.Err()
+	})
+	return res
+}
+
+// QueueQueryRow adds a statement to the batch whose first row is scanned into dest when the batch is executed. As with
+// pgx.Row, pgx.ErrNoRows is returned if the statement returns no rows.
+func (p *PGXBatcher) QueueQueryRow(sql string, args []any, dest ...any) *StatementResult {
+	return p.QueueQuery(sql, args, func(rows pgx.Rows) error {
+		if !rows.Next() {
+			if err := rows.Err(); err != nil {
+				return err
+			}
+			return pgx.ErrNoRows
+		}
+		return rows.Scan(dest...)
+	})
+}
+
+// QueueCopy adds a COPY of rows into table to the batch. As pgx.Batch cannot carry a COPY, Execute runs it on the
+// connection in queue order between the statements queued before and after it, inside the same transaction if the
+// batch is transactional. The connection must support CopyFrom, as *pgx.Conn does.
+//
+// rows can only be read once, so a batch containing a COPY is never retried.
+func (p *PGXBatcher) QueueCopy(table pgx.Identifier, columns []string, rows pgx.CopyFromSource) *StatementResult {
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = pgx.Identifier{column}.Sanitize()
 	}
+	sql := fmt.Sprintf("COPY %s (%s) FROM STDIN", table.Sanitize(), strings.Join(quoted, ", "))
 
-	return nil
+	_, res := p.queue(sql, nil)
+	p.statements[res.Index].copy = &copyFrom{table: table, columns: columns, rows: rows}
+	return res
+}
+
+func (p *PGXBatcher) queue(sql string, args []any) (*pgx.QueuedQuery, *StatementResult) {
+	res := &StatementResult{Index: len(p.queries)}
+	qq := p.batch.Queue(sql, args...)
+	p.queries = append(p.queries, sql)
+	p.statements = append(p.statements, statement{result: res})
+	p.markRefs(res.Index, args)
+	return qq, res
+}
+
+// Results returns the results of all queued statements in queue order.
+func (p *PGXBatcher) Results() []*StatementResult {
+	results := make([]*StatementResult, len(p.statements))
+	for i, s := range p.statements {
+		results[i] = s.result
+	}
+	return results
 }
 
 func (p *PGXBatcher) Reset() {
 	p.batch = &pgx.Batch{}
 	p.queries = []string{}
+	p.statements = nil
 }
@@ -6,9 +6,11 @@ import (
 	"fmt"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 var conn *pgx.Conn
@@ -32,6 +34,122 @@ func TestQueue(t *testing.T) {
 	}
 }
 
+func TestQueue_StatementResult(t *testing.T) {
+	t.Cleanup(func() { truncateUsers(t) })
+
+	b := New(conn, true)
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Alice", "alice@example.com")
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Bob", "bob@example.com")
+	update := b.Queue("UPDATE users SET email = lower(email)")
+
+	err := b.Execute(context.TODO())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if update.Index != 2 {
+		t.Errorf("Expected statement index 2, got %d", update.Index)
+	}
+	if !update.Executed || update.Err != nil {
+		t.Errorf("Expected statement to have executed without error, got executed=%v err=%v", update.Executed, update.Err)
+	}
+	if !update.CommandTag.Update() {
+		t.Errorf("Expected UPDATE command tag, got %q", update.CommandTag)
+	}
+	if update.RowsAffected < 2 {
+		t.Errorf("Expected at least 2 rows affected, got %d", update.RowsAffected)
+	}
+}
+
+func TestPGXBatcher_QueueQueryRow(t *testing.T) {
+	t.Cleanup(func() { truncateUsers(t) })
+
+	b := New(conn, true)
+	var aliceID, bobID int
+	b.QueueQueryRow("INSERT INTO users (name, email) VALUES ($1, $2) RETURNING id", []any{"Alice", "alice@example.com"}, &aliceID)
+	b.QueueQueryRow("INSERT INTO users (name, email) VALUES ($1, $2) RETURNING id", []any{"Bob", "bob@example.com"}, &bobID)
+
+	var names []string
+	res := b.QueueQuery("SELECT name FROM users WHERE name IN ($1, $2) ORDER BY id", []any{"Alice", "Bob"}, func(rows pgx.Rows) error {
+		var err error
+		names, err = pgx.CollectRows(rows, pgx.RowTo[string])
+		return err
+	})
+
+	err := b.Execute(context.TODO())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if aliceID == 0 || bobID == 0 || aliceID == bobID {
+		t.Errorf("Expected distinct generated ids, got %d and %d", aliceID, bobID)
+	}
+	if len(names) != 2 || names[0] != "Alice" || names[1] != "Bob" {
+		t.Errorf("Expected [Alice Bob], got %v", names)
+	}
+	if res.RowsAffected != 2 {
+		t.Errorf("Expected 2 rows affected, got %d", res.RowsAffected)
+	}
+
+	b = New(conn, false)
+	missing := b.QueueQueryRow("SELECT id FROM users WHERE name = $1", []any{"Carol"}, new(int))
+	err = b.Execute(context.TODO())
+	if !errors.Is(err, pgx.ErrNoRows) {
+		t.Fatalf("Expected pgx.ErrNoRows, got %v", err)
+	}
+	if !errors.Is(missing.Err, pgx.ErrNoRows) {
+		t.Errorf("Expected statement error pgx.ErrNoRows, got %v", missing.Err)
+	}
+
+	// a callback error rolls back a transactional batch
+	b = New(conn, true)
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Carol", "carol@example.com")
+	b.QueueQueryRow("SELECT id FROM users WHERE name = $1", []any{"Dave"}, new(int))
+	err = b.Execute(context.TODO())
+	if !errors.Is(err, pgx.ErrNoRows) {
+		t.Fatalf("Expected pgx.ErrNoRows, got %v", err)
+	}
+	var count int
+	err = conn.QueryRow(context.TODO(), "SELECT COUNT(*) FROM users WHERE name = 'Carol'").Scan(&count)
+	if err != nil {
+		t.Fatalf("Failed to query test table: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("Expected the batch to be rolled back, got %d rows", count)
+	}
+}
+
+func TestQueueCollect(t *testing.T) {
+	t.Cleanup(func() { truncateUsers(t) })
+
+	type user struct {
+		ID    int
+		Name  string
+		Email string
+	}
+
+	b := New(conn, true)
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Alice", "alice@example.com")
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Bob", "bob@example.com")
+	byName := QueueCollect[user](b, "SELECT id, name, email FROM users ORDER BY id", nil)
+	byPos := QueueCollectFunc(b, "SELECT id, name, email FROM users WHERE name = $1", []any{"Bob"}, pgx.RowToAddrOfStructByPos[user])
+
+	err := b.Execute(context.TODO())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	users := byName.Rows()
+	if len(users) != 2 || users[0].Name != "Alice" || users[1].Email != "bob@example.com" {
+		t.Errorf("Unexpected collected rows: %+v", users)
+	}
+	if byName.RowsAffected != 2 {
+		t.Errorf("Expected 2 rows affected, got %d", byName.RowsAffected)
+	}
+	if len(byPos.Rows()) != 1 || byPos.Rows()[0].ID != users[1].ID {
+		t.Errorf("Unexpected collected rows: %+v", byPos.Rows())
+	}
+}
+
 func TestPGXBatcher_Execute_Errors(t *testing.T) {
 	b := New(conn, false)
 
@@ -47,17 +165,537 @@ func TestPGXBatcher_Execute_Errors(t *testing.T) {
 		t.Error("Expected error, but got nil")
 	}
 
+	var stmtErr *StatementError
+	if !errors.As(err, &stmtErr) {
+		t.Fatalf("expected err of type *StatementError, got %T", err)
+	}
+	if stmtErr.Index != 1 || stmtErr.SQL != "INVALID SQL" {
+		t.Errorf("expected statement 1 to fail, got %d (%s)", stmtErr.Index, stmtErr.SQL)
+	}
+
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != "42601" { // Syntax error
+		t.Fatalf("Expected syntax error with code 42601, got %v", err)
+	}
+
+	// in a transactional batch the failure is not blamed on BEGIN
+	b = New(conn, true)
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Alice", "alice@example.com")
+	b.Queue("INVALID SQL")
+
+	err = b.Execute(context.TODO())
+	if !errors.As(err, &stmtErr) || stmtErr.Index != 1 {
+		t.Errorf("expected statement 1 to fail, got %v", err)
+	}
+}
+
+func TestPGXBatcher_Execute_StatementError(t *testing.T) {
+	b := New(conn, false)
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Alice", "alice@example.com")
+	res := b.Queue("SELECT $1::int / 0", 5)
+
+	err := b.Execute(context.TODO())
+
+	var stmtErrs StatementErrors
+	if !errors.As(err, &stmtErrs) || len(stmtErrs) != 1 {
+		t.Fatalf("expected one statement error, got %v", err)
+	}
+
+	var stmtErr *StatementError
+	if !errors.As(err, &stmtErr) {
+		t.Fatalf("expected err of type *StatementError, got %T", err)
+	}
+	if stmtErr.Index != 1 || stmtErr.SQL != "SELECT $1::int / 0" {
+		t.Errorf("expected statement 1 to fail, got %d (%s)", stmtErr.Index, stmtErr.SQL)
+	}
+	if len(stmtErr.Args) != 1 || stmtErr.Args[0] != "<int>" {
+		t.Errorf("expected redacted args, got %v", stmtErr.Args)
+	}
+	if res.Err == nil {
+		t.Error("expected statement result to hold the error")
+	}
+
 	var pgErr *pgconn.PgError
-	if errors.As(err, &pgErr) {
-		if pgErr.Code != "42601" { // Syntax error
-			t.Errorf("Expected syntax error with code 42601, got %s", pgErr.Code)
-			t.FailNow()
+	if !errors.As(err, &pgErr) || pgErr.Code != "22012" { // division_by_zero
+		t.Errorf("expected division_by_zero error, got %v", err)
+	}
+}
+
+func TestPGXBatcher_Execute_ContinueOnError(t *testing.T) {
+	t.Cleanup(func() { truncateUsers(t) })
+
+	b := NewWithOptions(conn, WithErrorMode(ContinueOnError))
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Alice", "alice@example.com")
+	b.Queue("SELECT $1::int / 0", 5)
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Bob", "bob@example.com")
+	b.Queue("INVALID SQL")
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Carol", "carol@example.com")
+
+	err := b.Execute(context.TODO())
+
+	var stmtErrs StatementErrors
+	if !errors.As(err, &stmtErrs) {
+		t.Fatalf("expected StatementErrors, got %v", err)
+	}
+	if len(stmtErrs) != 2 {
+		t.Fatalf("expected 2 statement errors, got %d: %v", len(stmtErrs), err)
+	}
+	for j, want := range []int{1, 3} {
+		if got := stmtErrs[j].(*StatementError).Index; got != want {
+			t.Errorf("expected statement %d to fail, got %d", want, got)
+		}
+	}
+
+	for _, res := range b.Results() {
+		failed := res.Index == 1 || res.Index == 3
+		if failed != (res.Err != nil) || !res.Executed {
+			t.Errorf("unexpected result for statement %d: executed=%v err=%v", res.Index, res.Executed, res.Err)
 		}
-		return
 	}
 
-	t.Error("expected err of type *pgconn.PgError, but got none")
-	t.FailNow()
+	var count int
+	err = conn.QueryRow(context.TODO(), "SELECT COUNT(*) FROM users WHERE name IN ('Alice', 'Bob', 'Carol')").Scan(&count)
+	if err != nil {
+		t.Fatalf("Failed to query test table: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("Expected 3 rows in test table, got %d", count)
+	}
+}
+
+// countingConn counts the batches sent on a connection.
+type countingConn struct {
+	*pgx.Conn
+	sent int
+}
+
+func (c *countingConn) SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults {
+	c.sent++
+	return c.Conn.SendBatch(ctx, b)
+}
+
+func TestPGXBatcher_Execute_ContinueOnError_Unpreparable(t *testing.T) {
+	c := &countingConn{Conn: conn}
+	b := NewWithOptions(c, WithErrorMode(ContinueOnError))
+	for i := range 20 {
+		sql := "DELETE FROM users WHERE id = $1"
+		if i == 5 || i == 15 {
+			sql = "DELET FROM users WHERE id = $1"
+		}
+		b.Queue(sql, i)
+	}
+
+	err := b.Execute(context.TODO())
+
+	var stmtErrs StatementErrors
+	if !errors.As(err, &stmtErrs) || len(stmtErrs) != 2 {
+		t.Fatalf("expected 2 statement errors, got %v", err)
+	}
+	for j, want := range []int{5, 15} {
+		if got := stmtErrs[j].(*StatementError).Index; got != want {
+			t.Errorf("expected statement %d to fail, got %d", want, got)
+		}
+	}
+	for _, res := range b.Results() {
+		failed := res.Index == 5 || res.Index == 15
+		if failed != (res.Err != nil) || !res.Executed {
+			t.Errorf("unexpected result for statement %d: executed=%v err=%v", res.Index, res.Executed, res.Err)
+		}
+	}
+	// the statements that cannot be prepared are found in a single pass rather than one round trip at a time
+	if c.sent != 2 {
+		t.Errorf("expected 2 round trips, got %d", c.sent)
+	}
+}
+
+func TestPGXBatcher_Execute_Savepoints(t *testing.T) {
+	t.Cleanup(func() { truncateUsers(t) })
+
+	// a statement that cannot be prepared is reported like one that fails, even in a later round trip
+	b := NewWithOptions(conn, WithTransactional(true), WithErrorMode(ContinueOnError), WithMaxStatementsPerRoundTrip(2))
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Alice", "alice@example.com")
+	b.Queue("SELECT $1::int / 0", 5)
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Bob", "bob@example.com")
+	b.Queue("INVALID SQL")
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Carol", "carol@example.com")
+
+	err := b.Execute(context.TODO())
+
+	var stmtErrs StatementErrors
+	if !errors.As(err, &stmtErrs) {
+		t.Fatalf("expected StatementErrors, got %v", err)
+	}
+	if len(stmtErrs) != 2 {
+		t.Fatalf("expected 2 statement errors, got %d: %v", len(stmtErrs), err)
+	}
+	for j, want := range []int{1, 3} {
+		if got := stmtErrs[j].(*StatementError).Index; got != want {
+			t.Errorf("expected statement %d to fail, got %d", want, got)
+		}
+	}
+	var pgErr *pgconn.PgError
+	if !errors.As(stmtErrs[1], &pgErr) || pgErr.Code != "42601" { // syntax_error
+		t.Errorf("expected statement 3 to fail with a syntax error, got %v", stmtErrs[1])
+	}
+
+	var count int
+	err = conn.QueryRow(context.TODO(), "SELECT COUNT(*) FROM users WHERE name IN ('Alice', 'Bob', 'Carol')").Scan(&count)
+	if err != nil {
+		t.Fatalf("Failed to query test table: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("Expected 3 rows in test table, got %d", count)
+	}
+}
+
+func TestPGXBatcher_WithTxOptions(t *testing.T) {
+	opt := WithTxOptions(pgx.TxOptions{IsoLevel: pgx.Serializable, AccessMode: pgx.ReadOnly, DeferrableMode: pgx.Deferrable})
+	b := NewWithOptions(conn, opt)
+
+	var isoLevel, readOnly string
+	b.QueueQueryRow("SHOW transaction_isolation", nil, &isoLevel)
+	b.QueueQueryRow("SHOW transaction_read_only", nil, &readOnly)
+
+	err := b.Execute(context.TODO())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if isoLevel != "serializable" || readOnly != "on" {
+		t.Errorf("Expected a serializable read only transaction, got %s and read only %s", isoLevel, readOnly)
+	}
+
+	b = NewWithOptions(conn, opt)
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Alice", "alice@example.com")
+
+	err = b.Execute(context.TODO())
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != "25006" { // read_only_sql_transaction
+		t.Errorf("Expected read_only_sql_transaction error, got %v", err)
+	}
+}
+
+func TestPGXBatcher_Execute_TransactionalError(t *testing.T) {
+	b := New(conn, true)
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Alice", "alice@example.com")
+	b.Queue("SELECT $1::int / 0", 5)
+
+	err := b.Execute(context.TODO())
+	if err == nil {
+		t.Fatal("expected an error, but got none")
+	}
+
+	// the failed transaction must have been rolled back for the connection to be usable again
+	var count int
+	err = conn.QueryRow(context.TODO(), "SELECT COUNT(*) FROM users WHERE name = 'Alice'").Scan(&count)
+	if err != nil {
+		t.Fatalf("Failed to query test table: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("Expected failed transaction to insert nothing, got %d rows", count)
+	}
+
+	// so is the same connection for the next batch, such as a retry
+	b = New(conn, true)
+	b.Queue("SELECT 1")
+	if err := b.Execute(context.TODO()); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestPGXBatcher_WithRetryPolicy(t *testing.T) {
+	t.Cleanup(func() { truncateUsers(t) })
+
+	_, err := conn.Exec(context.TODO(), "CREATE TEMPORARY SEQUENCE attempts")
+	if err != nil {
+		t.Fatalf("failed to create sequence: %v", err)
+	}
+	t.Cleanup(func() { _, _ = conn.Exec(context.TODO(), "DROP SEQUENCE attempts") })
+
+	// sequences are not transactional, so the first attempt fails and the retry succeeds
+	b := NewWithOptions(conn, WithTransactional(true), WithRetryPolicy(RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond}))
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Alice", "alice@example.com")
+	b.Queue(`DO $$ BEGIN IF nextval('attempts') = 1 THEN RAISE EXCEPTION 'conflict' USING ERRCODE = '40001'; END IF; END $$`)
+	res := b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Bob", "bob@example.com")
+
+	err = b.Execute(context.TODO())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if res.RowsAffected != 1 {
+		t.Errorf("Expected 1 row affected, got %d", res.RowsAffected)
+	}
+
+	var attempts, count int
+	err = conn.QueryRow(context.TODO(), "SELECT currval('attempts'), (SELECT COUNT(*) FROM users WHERE name IN ('Alice', 'Bob'))").Scan(&attempts, &count)
+	if err != nil {
+		t.Fatalf("Failed to query test table: %v", err)
+	}
+	if attempts != 2 || count != 2 {
+		t.Errorf("Expected 2 attempts and 2 rows in test table, got %d attempts and %d rows", attempts, count)
+	}
+
+	// retries stop after MaxAttempts
+	b = NewWithOptions(conn, WithTransactional(true), WithRetryPolicy(RetryPolicy{MaxAttempts: 3}))
+	b.Queue(`DO $$ BEGIN PERFORM nextval('attempts'); RAISE EXCEPTION 'conflict' USING ERRCODE = '40P01'; END $$`)
+
+	err = b.Execute(context.TODO())
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != "40P01" {
+		t.Fatalf("Expected deadlock_detected error, got %v", err)
+	}
+
+	err = conn.QueryRow(context.TODO(), "SELECT currval('attempts')").Scan(&attempts)
+	if err != nil {
+		t.Fatalf("Failed to query sequence: %v", err)
+	}
+	if attempts != 5 {
+		t.Errorf("Expected 3 more attempts, got %d", attempts-2)
+	}
+}
+
+func TestPGXBatcher_Chunks(t *testing.T) {
+	t.Cleanup(func() { truncateUsers(t) })
+
+	countUsers := func() int {
+		t.Helper()
+		var count int
+		err := conn.QueryRow(context.TODO(), "SELECT COUNT(*) FROM users").Scan(&count)
+		if err != nil {
+			t.Fatalf("Failed to query test table: %v", err)
+		}
+		return count
+	}
+	queue := func(b *PGXBatcher) {
+		for _, name := range []string{"Alice", "Bob", "Carol", "Dave"} {
+			b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", name, name+"@example.com")
+		}
+		b.Queue("SELECT $1::int / 0", 5)
+	}
+
+	// a transactional batch runs every chunk in the same transaction
+	var progress []Progress
+	b := NewWithOptions(conn, WithTransactional(true), WithMaxStatementsPerRoundTrip(2), WithProgress(func(p Progress) {
+		progress = append(progress, p)
+	}))
+	queue(b)
+
+	err := b.Execute(context.TODO())
+	if err == nil {
+		t.Fatal("expected an error, but got none")
+	}
+	if len(progress) != 3 || progress[2].Err == nil || progress[1].Completed != 4 || progress[2].Total != 5 {
+		t.Errorf("unexpected progress: %+v", progress)
+	}
+	if count := countUsers(); count != 0 {
+		t.Errorf("Expected failed transaction to insert nothing, got %d rows", count)
+	}
+
+	// a non-transactional batch commits each chunk on its own
+	progress = nil
+	b = NewWithOptions(conn, WithMaxStatementsPerRoundTrip(2), WithProgress(func(p Progress) {
+		progress = append(progress, p)
+	}))
+	queue(b)
+
+	err = b.Execute(context.TODO())
+	if err == nil {
+		t.Fatal("expected an error, but got none")
+	}
+	if len(progress) != 3 || progress[0].Err != nil || len(progress[0].Statements) != 2 {
+		t.Errorf("unexpected progress: %+v", progress)
+	}
+	if count := countUsers(); count != 4 {
+		t.Errorf("Expected 4 rows in test table, got %d", count)
+	}
+
+	// byte limits split the batch as well
+	progress = nil
+	b = NewWithOptions(conn, WithMaxBytesPerRoundTrip(1), WithProgress(func(p Progress) {
+		progress = append(progress, p)
+	}))
+	b.Queue("SELECT 1")
+	b.Queue("SELECT 2")
+
+	err = b.Execute(context.TODO())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(progress) != 2 {
+		t.Errorf("Expected 2 chunks, got %d", len(progress))
+	}
+}
+
+func TestPGXBatcher_QueueCopy(t *testing.T) {
+	t.Cleanup(func() { truncateUsers(t) })
+
+	b := New(conn, true)
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Alice", "alice@example.com")
+	copied := b.QueueCopy(pgx.Identifier{"users"}, []string{"name", "email"}, pgx.CopyFromRows([][]any{
+		{"Bob", "bob@example.com"},
+		{"Carol", "carol@example.com"},
+	}))
+	update := b.Queue("UPDATE users SET email = upper(email) WHERE name IN ('Bob', 'Carol')")
+
+	err := b.Execute(context.TODO())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if copied.RowsAffected != 2 || copied.CommandTag.String() != "COPY 2" {
+		t.Errorf("Expected COPY of 2 rows, got %q", copied.CommandTag)
+	}
+	if update.RowsAffected != 2 {
+		t.Errorf("Expected the UPDATE to see the copied rows, got %d rows affected", update.RowsAffected)
+	}
+
+	// a failing statement after the COPY rolls it back
+	b = New(conn, true)
+	b.QueueCopy(pgx.Identifier{"users"}, []string{"name", "email"}, pgx.CopyFromRows([][]any{{"Dave", "dave@example.com"}}))
+	b.Queue("SELECT $1::int / 0", 5)
+
+	err = b.Execute(context.TODO())
+	if err == nil {
+		t.Fatal("expected an error, but got none")
+	}
+
+	var count int
+	err = conn.QueryRow(context.TODO(), "SELECT COUNT(*) FROM users").Scan(&count)
+	if err != nil {
+		t.Fatalf("Failed to query test table: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("Expected 3 rows in test table, got %d", count)
+	}
+}
+
+func TestNewInTx(t *testing.T) {
+	tx, err := conn.Begin(context.TODO())
+	if err != nil {
+		t.Fatalf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback(context.TODO())
+
+	b := NewInTx(tx, WithErrorMode(ContinueOnError))
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Alice", "alice@example.com")
+	b.Queue("SELECT $1::int / 0", 5)
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Bob", "bob@example.com")
+
+	err = b.Execute(context.TODO())
+	var stmtErr *StatementError
+	if !errors.As(err, &stmtErr) || stmtErr.Index != 1 {
+		t.Fatalf("expected statement 1 to fail, got %v", err)
+	}
+
+	var count int
+	err = tx.QueryRow(context.TODO(), "SELECT COUNT(*) FROM users WHERE name IN ('Alice', 'Bob')").Scan(&count)
+	if err != nil {
+		t.Fatalf("Failed to query test table: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 rows in transaction, got %d", count)
+	}
+
+	// the batch was not committed, so rolling back the transaction discards it
+	if err := tx.Rollback(context.TODO()); err != nil {
+		t.Fatalf("failed to roll back transaction: %v", err)
+	}
+	err = conn.QueryRow(context.TODO(), "SELECT COUNT(*) FROM users WHERE name IN ('Alice', 'Bob')").Scan(&count)
+	if err != nil {
+		t.Fatalf("Failed to query test table: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("Expected no rows after rollback, got %d", count)
+	}
+}
+
+// wrappedPool wraps a pool the way a caller adding instrumentation would, exposing its Acquire method.
+type wrappedPool struct {
+	pool *pgxpool.Pool
+	sent int
+}
+
+func (w *wrappedPool) SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults {
+	w.sent++
+	return w.pool.SendBatch(ctx, b)
+}
+
+func (w *wrappedPool) Acquire(ctx context.Context) (*pgxpool.Conn, error) {
+	return w.pool.Acquire(ctx)
+}
+
+func TestPGXBatcher_Pool(t *testing.T) {
+	t.Cleanup(func() { truncateUsers(t) })
+
+	pool, err := pgxpool.New(context.TODO(), databaseURL())
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+	defer pool.Close()
+
+	countUsers := func() int {
+		t.Helper()
+		var count int
+		err := pool.QueryRow(context.TODO(), "SELECT COUNT(*) FROM users").Scan(&count)
+		if err != nil {
+			t.Fatalf("Failed to query test table: %v", err)
+		}
+		return count
+	}
+
+	// every chunk of a transactional batch runs on the same connection
+	b := NewWithOptions(pool, WithTransactional(true), WithMaxStatementsPerRoundTrip(1))
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Alice", "alice@example.com")
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Bob", "bob@example.com")
+
+	err = b.Execute(context.TODO())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if count := countUsers(); count != 2 {
+		t.Errorf("Expected 2 rows in test table, got %d", count)
+	}
+
+	// so does a batch executed on a type wrapping the pool
+	wrapped := &wrappedPool{pool: pool}
+	b = NewWithOptions(wrapped, WithTransactional(true), WithMaxStatementsPerRoundTrip(1))
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Alice", "alice@example.com")
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Bob", "bob@example.com")
+
+	err = b.Execute(context.TODO())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if wrapped.sent != 0 {
+		t.Errorf("Expected every round trip to be sent on an acquired connection, %d were sent on the pool", wrapped.sent)
+	}
+	if count := countUsers(); count != 4 {
+		t.Errorf("Expected 4 rows in test table, got %d", count)
+	}
+	truncateUsers(t)
+
+	// chunks of a non-transactional batch can be sent on separate connections
+	var progress []Progress
+	b = NewWithOptions(pool,
+		WithErrorMode(ContinueOnError),
+		WithMaxStatementsPerRoundTrip(2),
+		WithConcurrentChunks(3),
+		WithProgress(func(p Progress) { progress = append(progress, p) }),
+	)
+	for _, name := range []string{"Carol", "Dave", "Eve", "Frank", "Grace"} {
+		b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", name, name+"@example.com")
+	}
+	b.Queue("SELECT $1::int / 0", 5)
+
+	err = b.Execute(context.TODO())
+	var stmtErrs StatementErrors
+	if !errors.As(err, &stmtErrs) || len(stmtErrs) != 1 {
+		t.Fatalf("expected a single statement error, got %v", err)
+	}
+	if len(progress) != 3 || progress[2].Completed != 6 {
+		t.Errorf("unexpected progress: %+v", progress)
+	}
+	if count := countUsers(); count != 7 {
+		t.Errorf("Expected 7 rows in test table, got %d", count)
+	}
 }
 
 func TestPGXBatcher_Reset(t *testing.T) {
@@ -111,6 +749,14 @@ func TestPGXBatcher_ExecuteExecuted(t *testing.T) {
 	}
 }
 
+func truncateUsers(t *testing.T) {
+	t.Helper()
+	_, err := conn.Exec(context.TODO(), "TRUNCATE users")
+	if err != nil {
+		t.Fatalf("failed to truncate test table: %v", err)
+	}
+}
+
 func teardown(ctx context.Context, conn *pgx.Conn) error {
 	_, err := conn.Exec(ctx, "DROP TABLE IF EXISTS users")
 	if err != nil {
@@ -120,14 +766,17 @@ func teardown(ctx context.Context, conn *pgx.Conn) error {
 	return nil
 }
 
-func setupDBConnection(ctx context.Context) (*pgx.Conn, error) {
+func databaseURL() string {
 	username := os.Getenv("POSTGRES_USER")
 	password := os.Getenv("POSTGRES_PASSWORD")
 	db := os.Getenv("POSTGRES_DB")
 	host := os.Getenv("POSTGRES_HOST")
 
-	url := fmt.Sprintf("postgres://%s:%s@%s:5432/%s", username, password, host, db)
-	conn, err := pgx.Connect(ctx, url)
+	return fmt.Sprintf("postgres://%s:%s@%s:5432/%s", username, password, host, db)
+}
+
+func setupDBConnection(ctx context.Context) (*pgx.Conn, error) {
+	conn, err := pgx.Connect(ctx, databaseURL())
 	if err != nil {
 		return conn, fmt.Errorf("failed to connect to database: %v", err)
 	}
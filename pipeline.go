@@ -0,0 +1,446 @@
+package pgxbatcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// description is the outcome of describing a statement before it is sent on a pipeline.
+type description struct {
+	sd  *pgconn.StatementDescription
+	err error
+}
+
+// pipelineQuery is a step encoded for sending on a pipeline.
+type pipelineQuery struct {
+	sql string
+	eqb pgx.ExtendedQueryBuilder
+	sd  *pgconn.StatementDescription
+}
+
+// sentChunk is a chunk whose steps have been sent on a pipeline but whose results have not been read yet.
+type sentChunk struct {
+	n int
+	// segments are the steps that were sent, split at the sync points that follow them.
+	segments [][]step
+	// failures are the statements that could not be sent.
+	failures []int
+}
+
+// pipelineConn returns the *pgx.Conn underlying conn, if there is one. pgx.Tx and *pgxpool.Conn provide it with
+// their Conn method.
+func pipelineConn(conn BatchSender) (*pgx.Conn, bool) {
+	switch c := conn.(type) {
+	case *pgx.Conn:
+		return c, true
+	case interface{ Conn() *pgx.Conn }:
+		return c.Conn(), true
+	}
+	return nil, false
+}
+
+// supportsPipeline reports whether the batch can be executed on its connection in pipeline mode.
+func (p *PGXBatcher) supportsPipeline() bool {
+	if _, ok := p.conn.(acquirer); ok {
+		return true
+	}
+	_, ok := pipelineConn(p.conn)
+	return ok
+}
+
+// executePipeline executes the batch in pipeline mode. The distinct statements are described in a first round trip
+// so that their arguments can be encoded. Then each chunk is sent followed by a sync point, and the results of a
+// chunk are read once the next chunk has been sent, so that at most two chunks are held in memory. In
+// ContinueOnError mode every statement is followed by a sync point, so that it commits or fails on its own.
+//
+// In StopOnError mode no further chunks are sent once a chunk has failed, but the chunk that was sent after it has
+// already been executed unless the batch is transactional.
+func (p *PGXBatcher) executePipeline(ctx context.Context) error {
+	conn, _ := pipelineConn(p.conn)
+	steps := p.plan()
+	descriptions, err := p.describe(ctx, conn, steps)
+	if err != nil {
+		return err
+	}
+
+	if p.transactional {
+		// The transaction would be rolled back, so nothing is sent if a statement cannot be described. Within a
+		// transaction passed to NewInTx the failed description has already aborted the transaction.
+		for _, s := range steps {
+			sql, _, _ := p.stepQuery(ctx, s)
+			if d := descriptions[sql]; d.err != nil {
+				p.fail(s, d.err)
+				return p.statementErrors(s.indexes)
+			}
+		}
+	}
+
+	pipeline := conn.PgConn().StartPipeline(ctx)
+	results := &pipelineResults{pipeline: pipeline, typeMap: conn.TypeMap()}
+	chunks := p.chunks(steps)
+
+	var (
+		failures  []int
+		inFlight  []sentChunk
+		completed int
+		stopped   bool
+	)
+	read := func() error {
+		c := inFlight[0]
+		inFlight = inFlight[1:]
+
+		chunkFailures, err := p.readChunk(ctx, results, c.segments)
+		chunkFailures = append(c.failures, chunkFailures...)
+		failures = append(failures, chunkFailures...)
+		completed += countStatements(chunks[c.n])
+		chunkErr := p.statementErrors(chunkFailures)
+		if chunkErr == nil {
+			chunkErr = err
+		}
+		p.reportProgress(c.n, chunks[c.n], completed, chunkErr)
+
+		if err != nil || (p.errorMode == StopOnError && len(chunkFailures) > 0) {
+			stopped = true
+		}
+		return err
+	}
+
+	for c, chunk := range chunks {
+		if stopped {
+			break
+		}
+
+		steps := chunk
+		if c == 0 {
+			steps = append(p.begin(), steps...)
+		}
+		if c == len(chunks)-1 && !p.deferCommit() {
+			steps = append(steps, p.commit()...)
+		}
+
+		sent := sentChunk{n: c}
+		sent.segments, sent.failures = p.sendChunk(ctx, pipeline, results.typeMap, descriptions, steps)
+		if len(sent.segments) > 0 {
+			if err = pipeline.Flush(); err != nil {
+				break
+			}
+		}
+		inFlight = append(inFlight, sent)
+		if len(sent.failures) > 0 && p.errorMode == StopOnError {
+			// Nothing of the chunk was sent. The chunk before it is still read first, so that its results are
+			// reported in order.
+			break
+		}
+		if len(inFlight) > 1 {
+			if err = read(); err != nil {
+				break
+			}
+		}
+	}
+	// The results of the chunks that follow a failed chunk in a transaction are those of an aborted transaction, so
+	// they are not read.
+	for len(inFlight) > 0 && err == nil && !(stopped && p.transactional) {
+		err = read()
+	}
+
+	var pgErr *pgconn.PgError
+	if closeErr := pipeline.Close(); err == nil && closeErr != nil && !errors.As(closeErr, &pgErr) {
+		err = closeErr
+	}
+	if err == nil && len(failures) == 0 {
+		return p.commitDeferred(ctx)
+	}
+	p.rollback(ctx)
+
+	stmtErr := p.statementErrors(failures)
+	switch {
+	case err == nil:
+		return stmtErr
+	case stmtErr == nil:
+		return err
+	}
+	return errors.Join(stmtErr, err)
+}
+
+// describe describes the distinct statements of steps in a single round trip. Each statement is followed by a sync
+// point, so that a statement that fails to be described does not affect the others.
+func (p *PGXBatcher) describe(ctx context.Context, conn *pgx.Conn, steps []step) (map[string]description, error) {
+	descriptions := map[string]description{}
+	var sqls []string
+	for _, s := range steps {
+		sql, _, err := p.stepQuery(ctx, s)
+		if err != nil {
+			// The error is reported when the step is encoded.
+			continue
+		}
+		if _, ok := descriptions[sql]; !ok {
+			descriptions[sql] = description{}
+			sqls = append(sqls, sql)
+		}
+	}
+
+	pipeline := conn.PgConn().StartPipeline(ctx)
+	results := &pipelineResults{pipeline: pipeline}
+	for _, sql := range sqls {
+		pipeline.SendPrepare("", sql, nil)
+		pipeline.SendPipelineSync()
+	}
+	if err := pipeline.Flush(); err != nil {
+		return nil, err
+	}
+
+	for _, sql := range sqls {
+		res, err := pipeline.GetResults()
+		var pgErr *pgconn.PgError
+		switch {
+		case errors.As(err, &pgErr):
+			descriptions[sql] = description{err: err}
+		case err != nil:
+			pipeline.Close()
+			return nil, err
+		default:
+			sd, ok := res.(*pgconn.StatementDescription)
+			if !ok {
+				pipeline.Close()
+				return nil, fmt.Errorf("unexpected pipeline result %T", res)
+			}
+			descriptions[sql] = description{sd: sd}
+		}
+
+		if err := results.sync(); err != nil {
+			pipeline.Close()
+			return nil, err
+		}
+	}
+
+	return descriptions, pipeline.Close()
+}
+
+// sendChunk queues steps on pipeline, followed by a sync point, or with a sync point after every step in
+// ContinueOnError mode. It returns the steps that were queued, split at their sync points, and the indexes of the
+// statements that could not be sent because they could not be described or their arguments could not be encoded. In
+// StopOnError mode none of the steps is sent if one of them cannot be.
+func (p *PGXBatcher) sendChunk(ctx context.Context, pipeline *pgconn.Pipeline, m *pgtype.Map, descriptions map[string]description, steps []step) ([][]step, []int) {
+	queries := make([]*pipelineQuery, len(steps))
+	var failures []int
+	for k, s := range steps {
+		q, err := p.encode(ctx, m, descriptions, s)
+		if err != nil {
+			p.fail(s, err)
+			failures = append(failures, s.indexes...)
+			if p.errorMode == StopOnError {
+				return nil, failures
+			}
+			continue
+		}
+		queries[k] = q
+	}
+
+	var segments [][]step
+	var segment []step
+	for k, s := range steps {
+		q := queries[k]
+		if q == nil {
+			continue
+		}
+		if q.sd == nil {
+			pipeline.SendQueryParams(q.sql, q.eqb.ParamValues, nil, q.eqb.ParamFormats, nil)
+		} else {
+			pipeline.SendQueryParams(q.sql, q.eqb.ParamValues, q.sd.ParamOIDs, q.eqb.ParamFormats, q.eqb.ResultFormats)
+		}
+		segment = append(segment, s)
+		if p.errorMode == ContinueOnError {
+			pipeline.SendPipelineSync()
+			segments = append(segments, segment)
+			segment = nil
+		}
+	}
+	if len(segment) > 0 {
+		pipeline.SendPipelineSync()
+		segments = append(segments, segment)
+	}
+	return segments, failures
+}
+
+// encode encodes the arguments of s according to the description of its statement. Steps added by the batcher are not
+// described, so their arguments, such as an idempotency key, are sent as text for the server to infer their types.
+func (p *PGXBatcher) encode(ctx context.Context, m *pgtype.Map, descriptions map[string]description, s step) (*pipelineQuery, error) {
+	if len(s.indexes) == 0 {
+		q := &pipelineQuery{sql: s.sql}
+		if err := q.eqb.Build(m, nil, s.args); err != nil {
+			return nil, err
+		}
+		return q, nil
+	}
+
+	sql, args, err := p.stepQuery(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	d := descriptions[sql]
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	q := &pipelineQuery{sql: sql, sd: d.sd}
+	if err := q.eqb.Build(m, d.sd, args); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// readChunk reads the results of the segments of a chunk sent on a pipeline and returns the indexes of its failed
+// statements. An error is returned if a step added by the batcher failed or the connection was lost.
+func (p *PGXBatcher) readChunk(ctx context.Context, results *pipelineResults, segments [][]step) ([]int, error) {
+	var failures []int
+	var chunkErr error
+	for _, segment := range segments {
+		for _, s := range segment {
+			err := p.read(results, s)
+			p.traceStatements(ctx, s)
+			if err != nil {
+				if len(s.indexes) == 0 && chunkErr == nil {
+					chunkErr = err
+				}
+				failures = append(failures, s.indexes...)
+				// The server skips the rest of the segment after an error of its own. An error returned by a callback
+				// leaves the segment executed, so its results are still read.
+				if !p.callbackFailed(s) {
+					break
+				}
+			}
+		}
+		if err := results.sync(); err != nil {
+			return failures, err
+		}
+	}
+	return failures, chunkErr
+}
+
+// stepQuery returns the SQL and arguments that are sent for s, after applying a pgx.QueryRewriter passed as the first
+// argument of its statement.
+func (p *PGXBatcher) stepQuery(ctx context.Context, s step) (string, []any, error) {
+	if len(s.indexes) == 1 && s.sql == "" {
+		return p.rewrite(ctx, s.indexes[0])
+	}
+	return s.sql, s.args, nil
+}
+
+// fail records err as the result of the statements executed by s, which were not sent.
+func (p *PGXBatcher) fail(s step, err error) {
+	for _, i := range s.indexes {
+		p.statements[i].result.Err = err
+	}
+}
+
+// pipelineResults reads the results of the statements sent on a pipeline. It implements pgx.BatchResults so that the
+// functions of queued statements can read them.
+type pipelineResults struct {
+	pipeline *pgconn.Pipeline
+	typeMap  *pgtype.Map
+}
+
+func (r *pipelineResults) Exec() (pgconn.CommandTag, error) {
+	rr, err := r.next()
+	if err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	return rr.Close()
+}
+
+func (r *pipelineResults) Query() (pgx.Rows, error) {
+	rr, err := r.next()
+	if err != nil {
+		return &errRows{err: err}, err
+	}
+	return pgx.RowsFromResultReader(r.typeMap, rr), nil
+}
+
+func (r *pipelineResults) QueryRow() pgx.Row {
+	rows, _ := r.Query()
+	return &pipelineRow{rows: rows}
+}
+
+// Close does nothing, as the pipeline is closed by executePipeline.
+func (r *pipelineResults) Close() error {
+	return nil
+}
+
+// next returns the result of the next statement.
+func (r *pipelineResults) next() (*pgconn.ResultReader, error) {
+	res, err := r.pipeline.GetResults()
+	if err != nil {
+		return nil, err
+	}
+	rr, ok := res.(*pgconn.ResultReader)
+	if !ok {
+		return nil, fmt.Errorf("unexpected pipeline result %T", res)
+	}
+	return rr, nil
+}
+
+// sync discards results until the next sync point. Errors returned by the server are discarded as well, as they
+// belong to a statement whose error has already been read.
+func (r *pipelineResults) sync() error {
+	for {
+		res, err := r.pipeline.GetResults()
+		var pgErr *pgconn.PgError
+		switch {
+		case errors.As(err, &pgErr):
+			continue
+		case err != nil:
+			return err
+		}
+
+		switch res := res.(type) {
+		case *pgconn.PipelineSync:
+			return nil
+		case *pgconn.ResultReader:
+			if _, err := res.Close(); err != nil && !errors.As(err, &pgErr) {
+				return err
+			}
+		case nil:
+			return errors.New("pipeline sync point not received")
+		}
+	}
+}
+
+// pipelineRow is the pgx.Row returned by pipelineResults.QueryRow.
+type pipelineRow struct {
+	rows pgx.Rows
+}
+
+func (r *pipelineRow) Scan(dest ...any) error {
+	defer r.rows.Close()
+	if !r.rows.Next() {
+		if err := r.rows.Err(); err != nil {
+			return err
+		}
+		return pgx.ErrNoRows
+	}
+	if err := r.rows.Scan(dest...); err != nil {
+		return err
+	}
+	r.rows.Close()
+	return r.rows.Err()
+}
+
+// errRows is the pgx.Rows returned by pipelineResults.Query when a statement failed.
+type errRows struct {
+	err error
+}
+
+func (r *errRows) Close()                                       {}
+func (r *errRows) Err() error                                   { return r.err }
+func (r *errRows) CommandTag() pgconn.CommandTag                { return pgconn.CommandTag{} }
+func (r *errRows) FieldDescriptions() []pgconn.FieldDescription { return nil }
+func (r *errRows) Next() bool                                   { return false }
+func (r *errRows) Scan(...any) error                            { return r.err }
+func (r *errRows) Values() ([]any, error)                       { return nil, r.err }
+func (r *errRows) RawValues() [][]byte                          { return nil }
+func (r *errRows) Conn() *pgx.Conn                              { return nil }
@@ -0,0 +1,114 @@
+package pgxbatcher
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestPGXBatcher_WithPipeline(t *testing.T) {
+	t.Cleanup(func() { truncateUsers(t) })
+
+	var progress []Progress
+	b := NewWithOptions(conn, WithPipeline(), WithMaxStatementsPerRoundTrip(2), WithProgress(func(p Progress) {
+		progress = append(progress, p)
+	}))
+	var id int
+	b.QueueQueryRow("INSERT INTO users (name, email) VALUES ($1, $2) RETURNING id", []any{"Alice", "alice@example.com"}, &id)
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Bob", "bob@example.com")
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Carol", "carol@example.com")
+	failed := b.Queue("SELECT $1::int / 0", 5)
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Dave", "dave@example.com")
+
+	err := b.Execute(context.TODO())
+
+	var stmtErr *StatementError
+	if !errors.As(err, &stmtErr) || stmtErr.Index != 3 {
+		t.Fatalf("expected statement 3 to fail, got %v", err)
+	}
+	if id == 0 || failed.Err == nil {
+		t.Errorf("expected returned id and statement error, got %d and %v", id, failed.Err)
+	}
+	if len(progress) != 3 || progress[1].Err == nil {
+		t.Errorf("expected three chunks with the second failing, got %+v", progress)
+	}
+
+	// the first chunk commits on its own, the second is rolled back and the third was sent before the failure was read
+	var names []string
+	rows, _ := conn.Query(context.TODO(), "SELECT name FROM users ORDER BY id")
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatalf("Failed to scan name: %v", err)
+		}
+		names = append(names, name)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("Failed to query test table: %v", err)
+	}
+	if len(names) != 3 || names[0] != "Alice" || names[1] != "Bob" || names[2] != "Dave" {
+		t.Errorf("expected [Alice Bob Dave], got %v", names)
+	}
+}
+
+func TestPGXBatcher_WithPipeline_Transactional(t *testing.T) {
+	t.Cleanup(func() { truncateUsers(t) })
+
+	b := NewWithOptions(conn, WithPipeline(), WithTransactional(true), WithMaxStatementsPerRoundTrip(1))
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Alice", "alice@example.com")
+	b.Queue("SELECT $1::int / 0", 5)
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Bob", "bob@example.com")
+
+	err := b.Execute(context.TODO())
+
+	var stmtErrs StatementErrors
+	if !errors.As(err, &stmtErrs) || len(stmtErrs) != 1 || stmtErrs[0].(*StatementError).Index != 1 {
+		t.Fatalf("expected statement 1 to fail, got %v", err)
+	}
+
+	var count int
+	if err := conn.QueryRow(context.TODO(), "SELECT COUNT(*) FROM users").Scan(&count); err != nil {
+		t.Fatalf("Failed to query test table: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("Expected failed transaction to insert nothing, got %d rows", count)
+	}
+
+	b = NewWithOptions(conn, WithPipeline(), WithErrorMode(ContinueOnError))
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Alice", "alice@example.com")
+	b.Queue("SELECT nme FROM users")
+	b.Queue("SELECT $1::int / 0", 5)
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Bob", "bob@example.com")
+
+	err = b.Execute(context.TODO())
+	if !errors.As(err, &stmtErrs) || len(stmtErrs) != 2 {
+		t.Fatalf("expected two statement errors, got %v", err)
+	}
+	if err := conn.QueryRow(context.TODO(), "SELECT COUNT(*) FROM users").Scan(&count); err != nil {
+		t.Fatalf("Failed to query test table: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 rows in test table, got %d", count)
+	}
+}
+
+func TestPGXBatcher_WithPipeline_CallbackError(t *testing.T) {
+	t.Cleanup(func() { truncateUsers(t) })
+
+	errCallback := errors.New("callback failed")
+	b := NewWithOptions(conn, WithPipeline())
+	failed := b.QueueQuery("SELECT 1", nil, func(rows pgx.Rows) error { return errCallback })
+	inserted := b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Alice", "alice@example.com")
+
+	err := b.Execute(context.TODO())
+
+	if !errors.Is(err, errCallback) || !errors.Is(failed.Err, errCallback) {
+		t.Fatalf("expected the callback error, got %v", err)
+	}
+	// the server executed the rest of the segment, so its results are still read
+	if !inserted.Executed || inserted.Err != nil || inserted.RowsAffected != 1 {
+		t.Errorf("expected statement %d to insert one row, got executed=%v rows=%d err=%v", inserted.Index, inserted.Executed, inserted.RowsAffected, inserted.Err)
+	}
+}
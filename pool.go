@@ -0,0 +1,89 @@
+package pgxbatcher
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// on returns a copy of p that sends its statements on conn. The copy shares the queued statements and their results
+// with p.
+func (p *PGXBatcher) on(conn BatchSender) *PGXBatcher {
+	q := *p
+	q.conn = conn
+	return &q
+}
+
+// executeConcurrent executes the chunks of a non-transactional batch on separate connections acquired from pool,
+// sending up to p.concurrentChunks of them at a time. Chunks may complete in any order. In StopOnError mode no further
+// chunks are sent once a chunk has failed, but chunks that are already running are completed.
+func (p *PGXBatcher) executeConcurrent(ctx context.Context, pool acquirer) error {
+	var (
+		mu        sync.Mutex
+		wg        sync.WaitGroup
+		failures  []int
+		errs      []error
+		completed int
+	)
+	stopped := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return p.errorMode == StopOnError && (len(failures) > 0 || len(errs) > 0)
+	}
+
+	sem := make(chan struct{}, p.concurrentChunks)
+	for c, chunk := range p.chunks(p.plan()) {
+		sem <- struct{}{}
+		if stopped() {
+			<-sem
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			var chunkFailures []int
+			conn, err := pool.Acquire(ctx)
+			if err == nil {
+				chunkFailures, err = p.on(conn).executeChunk(ctx, chunk)
+				conn.Release()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			failures = append(failures, chunkFailures...)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			completed += countStatements(chunk)
+			chunkErr := p.statementErrors(chunkFailures)
+			if chunkErr == nil {
+				chunkErr = err
+			}
+			p.reportProgress(c, chunk, completed, chunkErr)
+		}()
+	}
+	wg.Wait()
+
+	err := p.statementErrors(failures)
+	if len(errs) == 0 {
+		return err
+	}
+	return errors.Join(append([]error{err}, errs...)...)
+}
+
+// executeChunk executes the steps of a chunk of a non-transactional batch according to the batch's error mode. It
+// returns the indexes of the failed statements, or an error if the chunk failed without a statement to blame.
+func (p *PGXBatcher) executeChunk(ctx context.Context, steps []step) ([]int, error) {
+	if p.errorMode == ContinueOnError {
+		return p.executeChunkContinue(ctx, steps), nil
+	}
+
+	failed, err := p.run(ctx, steps)
+	if err != nil && len(failed.indexes) > 0 {
+		return failed.indexes, nil
+	}
+	return nil, err
+}
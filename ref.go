@@ -0,0 +1,242 @@
+package pgxbatcher
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Ref refers to a column returned by a queued statement, such as the id returned by
+// "INSERT INTO parents (name) VALUES ($1) RETURNING id". It is created with StatementResult.Ref and passed as an
+// argument to a statement queued after it, in place of the value the column will hold.
+//
+// Statements linked by Refs form a chain that is executed as a single statement with data-modifying common table
+// expressions, in place of the last statement of the chain:
+//
+//	WITH pgxbatcher_0 AS (INSERT INTO parents (name) VALUES ($1) RETURNING id)
+//	INSERT INTO children (parent_id, name) VALUES ((SELECT "id" FROM pgxbatcher_0), $2)
+//
+// The statements of a chain must be queued one after another, without unrelated statements between them, and a
+// referenced statement must return a single row. All statements of a chain but the last must be queued with Queue
+// and be statements that can appear in a WITH clause, i.e. SELECT, INSERT, UPDATE, DELETE or MERGE. They all see the
+// same snapshot of the database, so they cannot see each other's changes other than through Refs. The chain succeeds
+// or fails as a whole. Only the last statement's result carries a command tag and returned rows.
+type Ref struct {
+	result *StatementResult
+	column string
+}
+
+// Ref returns a reference to column of the row returned by the statement, to be passed as an argument to a statement
+// queued after it in the same batch.
+func (r *StatementResult) Ref(column string) Ref {
+	return Ref{result: r, column: column}
+}
+
+// markRefs records the statements referenced by the arguments of statement j. Only Refs passed directly as arguments
+// are recognized.
+func (p *PGXBatcher) markRefs(j int, args []any) {
+	for _, arg := range args {
+		ref, ok := arg.(Ref)
+		if !ok {
+			continue
+		}
+		p.statements[j].refs = true
+		if ref.result == nil {
+			continue
+		}
+		if i := ref.result.Index; i < j && p.statements[i].result == ref.result {
+			p.statements[i].referenced = true
+		}
+	}
+}
+
+// checkRefs returns an error wrapping ErrInvalidRef if a Ref refers to a statement of another batch, if an unrelated
+// statement is queued between the statements of a chain, which would run before the chain rather than between its
+// statements, or if a chain holds a statement other than its last one that cannot be rewritten into a common table
+// expression.
+func (p *PGXBatcher) checkRefs() error {
+	for j, s := range p.statements {
+		if !s.refs {
+			continue
+		}
+		for _, arg := range p.batch.QueuedQueries[j].Arguments {
+			ref, ok := arg.(Ref)
+			if !ok {
+				continue
+			}
+			if ref.result == nil || ref.result.Index >= j || p.statements[ref.result.Index].result != ref.result {
+				return fmt.Errorf("statement %d: %w: it refers to a statement of another batch", j, ErrInvalidRef)
+			}
+		}
+	}
+
+	for _, chain := range p.chains() {
+		for k := 1; k < len(chain); k++ {
+			if i := chain[k-1] + 1; chain[k] != i {
+				return fmt.Errorf("statement %d: %w: it is queued between statements linked by Refs", i, ErrInvalidRef)
+			}
+		}
+		for _, i := range chain[:len(chain)-1] {
+			if s := p.statements[i]; s.rows || s.expect != nil || s.copy != nil {
+				return fmt.Errorf("statement %d: %w: only statements queued with Queue can be referenced", i, ErrInvalidRef)
+			}
+		}
+		for _, i := range chain {
+			sql, args, err := p.rewrite(context.Background(), i)
+			if err == nil {
+				_, err = interpolate(sql, make([]string, len(args)))
+			}
+			if err != nil {
+				return fmt.Errorf("statement %d: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// chains returns the indexes of the statements linked by Refs, grouped into chains in queue order.
+func (p *PGXBatcher) chains() [][]int {
+	if !slices.ContainsFunc(p.statements, func(s statement) bool { return s.refs }) {
+		return nil
+	}
+
+	root := make([]int, len(p.statements))
+	for i := range root {
+		root[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if root[i] != i {
+			root[i] = find(root[i])
+		}
+		return root[i]
+	}
+
+	for j, s := range p.statements {
+		if !s.refs {
+			continue
+		}
+		for _, arg := range p.batch.QueuedQueries[j].Arguments {
+			if ref, ok := arg.(Ref); ok && ref.result != nil && ref.result.Index < j {
+				root[find(j)] = find(ref.result.Index)
+			}
+		}
+	}
+
+	members := map[int][]int{}
+	var roots []int
+	for i, s := range p.statements {
+		if !s.refs && !s.referenced {
+			continue
+		}
+		r := find(i)
+		if _, ok := members[r]; !ok {
+			roots = append(roots, r)
+		}
+		members[r] = append(members[r], i)
+	}
+
+	chains := make([][]int, len(roots))
+	for k, r := range roots {
+		chains[k] = members[r]
+	}
+	return chains
+}
+
+// chainSteps replaces the steps of each chain of statements linked by Refs with a single step executing the chain,
+// which takes the place of the chain's last statement. Statements in chains are never merged, so each of them has a
+// step of its own.
+func (p *PGXBatcher) chainSteps(steps []step) []step {
+	chains := p.chains()
+	if len(chains) == 0 {
+		return steps
+	}
+
+	last := map[int][]int{}
+	for _, chain := range chains {
+		last[chain[len(chain)-1]] = chain
+	}
+
+	chained := make([]step, 0, len(steps))
+	for _, s := range steps {
+		i := s.indexes[0]
+		switch {
+		case !p.statements[i].refs && !p.statements[i].referenced:
+			chained = append(chained, s)
+		case last[i] != nil:
+			chained = append(chained, p.chainStep(last[i]))
+		}
+	}
+	return chained
+}
+
+// chainStep returns the step executing chain as a single statement. Every statement but the last becomes a common
+// table expression named after its index, and each Ref is replaced by a scalar subquery selecting its column from the
+// expression of the statement it refers to. The remaining placeholders are renumbered.
+func (p *PGXBatcher) chainStep(chain []int) step {
+	s := step{indexes: chain, chained: true}
+
+	var ctes []string
+	var main string
+	for k, i := range chain {
+		sql, args, _ := p.rewrite(context.Background(), i)
+		replacements := make([]string, len(args))
+		for j, arg := range args {
+			if ref, ok := arg.(Ref); ok {
+				replacements[j] = fmt.Sprintf("(SELECT %s FROM %s)", pgx.Identifier{ref.column}.Sanitize(), cteName(ref.result.Index))
+				continue
+			}
+			s.args = append(s.args, arg)
+			replacements[j] = "$" + strconv.Itoa(len(s.args))
+		}
+		// checkRefs has made sure that every placeholder has an argument.
+		sql, _ = interpolate(sql, replacements)
+		sql = trimStatement(sql)
+
+		if k == len(chain)-1 {
+			main = sql
+			break
+		}
+		ctes = append(ctes, cteName(i)+" AS ("+sql+")")
+	}
+
+	// A WITH clause of the last statement is merged into the one holding the chain.
+	with := "WITH "
+	if rest, ok := cutKeyword(main, "WITH"); ok {
+		if r, ok := cutKeyword(rest, "RECURSIVE"); ok {
+			with, rest = "WITH RECURSIVE ", r
+		}
+		main = ", " + rest
+	} else {
+		main = " " + main
+	}
+	s.sql = with + strings.Join(ctes, ", ") + main
+	return s
+}
+
+func cteName(i int) string {
+	return "pgxbatcher_" + strconv.Itoa(i)
+}
+
+// cutKeyword returns sql without its leading keyword kw and the whitespace following it, if sql starts with kw.
+func cutKeyword(sql, kw string) (string, bool) {
+	sql = strings.TrimLeft(sql, " \t\r\n")
+	if len(sql) <= len(kw) || !strings.EqualFold(sql[:len(kw)], kw) || isIdentChar(sql[len(kw)]) {
+		return "", false
+	}
+	return strings.TrimLeft(sql[len(kw):], " \t\r\n"), true
+}
+
+// trimStatement removes the semicolon and whitespace at the end of sql. A line break is kept if the statement may end
+// in a comment, which would otherwise swallow what follows the statement.
+func trimStatement(sql string) string {
+	sql = strings.TrimRight(sql, " \t\r\n;")
+	if strings.Contains(sql[strings.LastIndexByte(sql, '\n')+1:], "--") {
+		sql += "\n"
+	}
+	return sql
+}
@@ -0,0 +1,85 @@
+package pgxbatcher
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestPGXBatcher_Ref_Render(t *testing.T) {
+	b := New(conn, false)
+	b.Queue("SELECT $1::int", 1)
+	parent := b.Queue("INSERT INTO parents (name) VALUES ($1) RETURNING id;", "p")
+	child := b.Queue("INSERT INTO children (parent_id, name) VALUES ($1, $2) RETURNING id", parent.Ref("id"), "c")
+	b.Queue("WITH x AS (SELECT $1::text AS name) INSERT INTO toys (child_id, name) SELECT $2, name FROM x", "t", child.Ref("id"))
+
+	want := "SELECT 1::int;\n" +
+		"WITH pgxbatcher_1 AS (INSERT INTO parents (name) VALUES ('p') RETURNING id), " +
+		"pgxbatcher_2 AS (INSERT INTO children (parent_id, name) VALUES ((SELECT \"id\" FROM pgxbatcher_1), 'c') RETURNING id), " +
+		"x AS (SELECT 't'::text AS name) INSERT INTO toys (child_id, name) SELECT (SELECT \"id\" FROM pgxbatcher_2), name FROM x;\n"
+
+	got, err := b.Render()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got != want {
+		t.Errorf("unexpected script:\n%s\nwant:\n%s", got, want)
+	}
+
+	other := New(conn, false)
+	other.Queue("INSERT INTO children (parent_id) VALUES ($1)", parent.Ref("id"))
+	if _, err := other.Render(); !errors.Is(err, ErrInvalidRef) {
+		t.Errorf("expected ErrInvalidRef for a Ref to another batch, got %v", err)
+	}
+
+	b = New(conn, false)
+	parent = b.Queue("INSERT INTO parents (name) VALUES ($1) RETURNING id", "p")
+	b.Queue("UPDATE parents SET name = $1 WHERE name = $2", "q", "p")
+	b.Queue("INSERT INTO children (parent_id) VALUES ($1)", parent.Ref("id"))
+	if _, err := b.Render(); !errors.Is(err, ErrInvalidRef) {
+		t.Errorf("expected ErrInvalidRef for a statement queued between the statements of a chain, got %v", err)
+	}
+
+	b = New(conn, false)
+	row := b.QueueQueryRow("INSERT INTO parents (name) VALUES ($1) RETURNING id", []any{"p"}, new(int))
+	b.Queue("INSERT INTO children (parent_id) VALUES ($1)", row.Ref("id"))
+	if _, err := b.Render(); !errors.Is(err, ErrInvalidRef) {
+		t.Errorf("expected ErrInvalidRef for a Ref to a statement returning rows, got %v", err)
+	}
+}
+
+func TestPGXBatcher_Ref(t *testing.T) {
+	_, err := conn.Exec(context.TODO(), "CREATE TABLE IF NOT EXISTS emails (id SERIAL PRIMARY KEY, user_id INT NOT NULL REFERENCES users (id) ON DELETE CASCADE, email TEXT)")
+	if err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+	t.Cleanup(func() {
+		_, _ = conn.Exec(context.TODO(), "DROP TABLE emails")
+		truncateUsers(t)
+	})
+
+	b := New(conn, true)
+	user := b.Queue("INSERT INTO users (name) VALUES ($1) RETURNING id", "Alice")
+	b.Queue("INSERT INTO emails (user_id, email) VALUES ($1, $2)", user.Ref("id"), "alice@example.com")
+	var userID int
+	last := b.QueueQueryRow("INSERT INTO emails (user_id, email) VALUES ($1, $2) RETURNING user_id", []any{user.Ref("id"), "alice@example.org"}, &userID)
+
+	if err := b.Execute(context.TODO()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !user.Executed || last.RowsAffected != 1 {
+		t.Errorf("expected the chain to be executed, got %+v and %+v", user, last)
+	}
+
+	var ids []int
+	rows, _ := conn.Query(context.TODO(), "SELECT e.user_id FROM emails e JOIN users u ON u.id = e.user_id WHERE u.name = 'Alice'")
+	ids, err = pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		t.Fatalf("Failed to query emails: %v", err)
+	}
+	if len(ids) != 2 || ids[0] != userID || ids[1] != userID {
+		t.Errorf("expected two emails of user %d, got %v", userID, ids)
+	}
+}
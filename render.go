@@ -0,0 +1,306 @@
+package pgxbatcher
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Render returns the SQL script that Execute would send, with the arguments of each statement interpolated as
+// literals. Transactional batches are enclosed in BEGIN and COMMIT, and merged INSERTs are rendered as merged. A COPY is
+// rendered as a comment as its rows can only be read once. Statements in ContinueOnError mode are rendered without
+// savepoints, so the script stops at the first error when run with psql -v ON_ERROR_STOP=1.
+//
+// The script is meant for review and debugging. Values are rendered in their text format, which may differ from how
+// they would be encoded when the batch is executed.
+func (p *PGXBatcher) Render() (string, error) {
+	var sb strings.Builder
+	_, err := p.WriteTo(&sb)
+	return sb.String(), err
+}
+
+// WriteTo writes the script returned by Render to w, one statement at a time.
+func (p *PGXBatcher) WriteTo(w io.Writer) (int64, error) {
+	if err := p.checkRefs(); err != nil {
+		return 0, err
+	}
+
+	m := pgtype.NewMap()
+	var written int64
+	write := func(sql string) error {
+		n, err := io.WriteString(w, sql)
+		written += int64(n)
+		return err
+	}
+
+	for _, s := range append(p.begin(), p.plan()...) {
+		sql, err := p.renderStep(m, s)
+		if err != nil {
+			return written, err
+		}
+		if err := write(sql); err != nil {
+			return written, err
+		}
+	}
+	for _, s := range p.commit() {
+		if err := write(s.sql + ";\n"); err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// renderStep renders s as one or more lines of the script.
+func (p *PGXBatcher) renderStep(m *pgtype.Map, s step) (string, error) {
+	if p.isCopy(s) {
+		return "-- " + p.queries[s.indexes[0]] + " (rows not rendered)\n", nil
+	}
+
+	sql, args := s.sql, s.args
+	if sql == "" {
+		qq := p.batch.QueuedQueries[s.indexes[0]]
+		sql, args = qq.SQL, qq.Arguments
+	}
+	if len(args) > 0 {
+		if qr, ok := args[0].(pgx.QueryRewriter); ok {
+			var err error
+			sql, args, err = qr.RewriteQuery(context.Background(), nil, sql, args[1:])
+			if err != nil {
+				return "", fmt.Errorf("statement %d: %w", s.indexes[0], err)
+			}
+		}
+	}
+
+	literals := make([]string, len(args))
+	for j, arg := range args {
+		lit, err := literal(m, arg)
+		if err != nil {
+			return "", fmt.Errorf("statement %d: argument $%d: %w", s.indexes[0], j+1, err)
+		}
+		literals[j] = lit
+	}
+	rendered, err := interpolate(sql, literals)
+	if err != nil {
+		return "", fmt.Errorf("statement %d: %w", s.indexes[0], err)
+	}
+
+	return trimStatement(rendered) + ";\n", nil
+}
+
+// literal returns arg as an SQL literal.
+func literal(m *pgtype.Map, arg any) (string, error) {
+	switch arg := arg.(type) {
+	case nil:
+		return "NULL", nil
+	case string:
+		return quote(arg), nil
+	case []byte:
+		if arg == nil {
+			return "NULL", nil
+		}
+		return `'\x` + hex.EncodeToString(arg) + "'::bytea", nil
+	case bool:
+		return strconv.FormatBool(arg), nil
+	case int:
+		return numberLiteral(strconv.FormatInt(int64(arg), 10)), nil
+	case int8:
+		return numberLiteral(strconv.FormatInt(int64(arg), 10)), nil
+	case int16:
+		return numberLiteral(strconv.FormatInt(int64(arg), 10)), nil
+	case int32:
+		return numberLiteral(strconv.FormatInt(int64(arg), 10)), nil
+	case int64:
+		return numberLiteral(strconv.FormatInt(arg, 10)), nil
+	case uint:
+		return strconv.FormatUint(uint64(arg), 10), nil
+	case uint8:
+		return strconv.FormatUint(uint64(arg), 10), nil
+	case uint16:
+		return strconv.FormatUint(uint64(arg), 10), nil
+	case uint32:
+		return strconv.FormatUint(uint64(arg), 10), nil
+	case uint64:
+		return strconv.FormatUint(arg, 10), nil
+	case float32:
+		return floatLiteral(float64(arg)), nil
+	case float64:
+		return floatLiteral(arg), nil
+	case time.Time:
+		return quote(arg.Truncate(time.Microsecond).Format("2006-01-02 15:04:05.999999Z07:00:00")) + "::timestamptz", nil
+	case driver.Valuer:
+		if v := reflect.ValueOf(arg); v.Kind() == reflect.Pointer && v.IsNil() {
+			return "NULL", nil
+		}
+		v, err := arg.Value()
+		if err != nil {
+			return "", err
+		}
+		return literal(m, v)
+	}
+
+	if v := reflect.ValueOf(arg); v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return "NULL", nil
+		}
+		return literal(m, v.Elem().Interface())
+	}
+
+	// Anything else, e.g. arrays, UUIDs or JSON, is rendered in its text format and cast to its type.
+	typ, ok := m.TypeForValue(arg)
+	if !ok {
+		return "", fmt.Errorf("cannot render %T", arg)
+	}
+	buf, err := m.Encode(typ.OID, pgtype.TextFormatCode, arg, nil)
+	if err != nil {
+		return "", err
+	}
+	if buf == nil {
+		return "NULL", nil
+	}
+	return quote(string(buf)) + "::" + pgx.Identifier{typ.Name}.Sanitize(), nil
+}
+
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// numberLiteral encloses negative numbers in parentheses, so that a minus sign following another one in the statement
+// cannot start a comment.
+func numberLiteral(s string) string {
+	if strings.HasPrefix(s, "-") {
+		return "(" + s + ")"
+	}
+	return s
+}
+
+func floatLiteral(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "'NaN'::float8"
+	case math.IsInf(f, 1):
+		return "'Infinity'::float8"
+	case math.IsInf(f, -1):
+		return "'-Infinity'::float8"
+	}
+	return numberLiteral(strconv.FormatFloat(f, 'g', -1, 64)) + "::float8"
+}
+
+// interpolate replaces the placeholders $1, $2, ... in sql with literals. Placeholders are not recognized inside
+// string constants, quoted identifiers, dollar-quoted strings and comments.
+func interpolate(sql string, literals []string) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		var end int
+		switch {
+		case c == '\'':
+			// Backslash escapes are only recognized in escape string constants such as E'\n'.
+			escapes := i > 0 && (sql[i-1] == 'E' || sql[i-1] == 'e') && (i < 2 || !isIdentChar(sql[i-2]))
+			end = endOfQuoted(sql, i, '\'', escapes)
+		case c == '"':
+			end = endOfQuoted(sql, i, '"', false)
+		case c == '-' && strings.HasPrefix(sql[i:], "--"):
+			end = strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				end = len(sql)
+			} else {
+				end += i + 1
+			}
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			end = endOfComment(sql, i)
+		case c == '$' && (i == 0 || !isIdentChar(sql[i-1])):
+			j := i + 1
+			for j < len(sql) && sql[j] >= '0' && sql[j] <= '9' {
+				j++
+			}
+			if j > i+1 {
+				n, err := strconv.Atoi(sql[i+1 : j])
+				if err != nil || n < 1 || n > len(literals) {
+					return "", fmt.Errorf("no argument for placeholder %s", sql[i:j])
+				}
+				sb.WriteString(literals[n-1])
+				i = j
+				continue
+			}
+			end = endOfDollarQuoted(sql, i)
+		default:
+			end = i + 1
+		}
+
+		sb.WriteString(sql[i:end])
+		i = end
+	}
+	return sb.String(), nil
+}
+
+// endOfQuoted returns the position after the string constant or quoted identifier starting at i. A doubled quote
+// stands for the quote itself.
+func endOfQuoted(sql string, i int, q byte, escapes bool) int {
+	for j := i + 1; j < len(sql); j++ {
+		switch {
+		case escapes && sql[j] == '\\':
+			j++
+		case sql[j] == q && j+1 < len(sql) && sql[j+1] == q:
+			j++
+		case sql[j] == q:
+			return j + 1
+		}
+	}
+	return len(sql)
+}
+
+// endOfComment returns the position after the block comment starting at i. Block comments nest.
+func endOfComment(sql string, i int) int {
+	depth := 0
+	for j := i; j < len(sql)-1; j++ {
+		switch {
+		case sql[j] == '/' && sql[j+1] == '*':
+			depth++
+			j++
+		case sql[j] == '*' && sql[j+1] == '/':
+			depth--
+			j++
+			if depth == 0 {
+				return j + 1
+			}
+		}
+	}
+	return len(sql)
+}
+
+// endOfDollarQuoted returns the position after the dollar-quoted string starting at i, such as $$...$$ or
+// $tag$...$tag$. If no string starts at i, the position after the dollar sign is returned.
+func endOfDollarQuoted(sql string, i int) int {
+	j := i + 1
+	for j < len(sql) && isTagChar(sql[j]) {
+		j++
+	}
+	if j == len(sql) || sql[j] != '$' || (j > i+1 && sql[i+1] >= '0' && sql[i+1] <= '9') {
+		return i + 1
+	}
+
+	tag := sql[i : j+1]
+	end := strings.Index(sql[j+1:], tag)
+	if end < 0 {
+		return len(sql)
+	}
+	return j + 1 + end + len(tag)
+}
+
+func isIdentChar(c byte) bool {
+	return c == '$' || isTagChar(c)
+}
+
+func isTagChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
@@ -0,0 +1,71 @@
+package pgxbatcher
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestInterpolate(t *testing.T) {
+	literals := []string{"'a'", "(-1)"}
+	tests := []struct {
+		sql  string
+		want string
+	}{
+		{"SELECT $1, $2", "SELECT 'a', (-1)"},
+		{"SELECT $1 - $2", "SELECT 'a' - (-1)"},
+		{"SELECT '$1', \"$1\", $1", "SELECT '$1', \"$1\", 'a'"},
+		{"SELECT 'it''s $1', $1", "SELECT 'it''s $1', 'a'"},
+		{"SELECT E'\\' $1', $1", "SELECT E'\\' $1', 'a'"},
+		{"SELECT $$ $1 $$, $tag$ $1 $tag$, $1", "SELECT $$ $1 $$, $tag$ $1 $tag$, 'a'"},
+		{"SELECT $1 -- $2\n, $2", "SELECT 'a' -- $2\n, (-1)"},
+		{"SELECT /* $1 /* $1 */ $1 */ $2", "SELECT /* $1 /* $1 */ $1 */ (-1)"},
+		{"SELECT a$1 FROM t", "SELECT a$1 FROM t"},
+	}
+	for _, tt := range tests {
+		got, err := interpolate(tt.sql, literals)
+		if err != nil {
+			t.Errorf("interpolate(%q): unexpected error: %v", tt.sql, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("interpolate(%q) = %q, want %q", tt.sql, got, tt.want)
+		}
+	}
+
+	if _, err := interpolate("SELECT $3", literals); err == nil {
+		t.Error("expected an error for a placeholder without an argument")
+	}
+}
+
+func TestPGXBatcher_Render(t *testing.T) {
+	b := NewWithOptions(conn, WithTxOptions(pgx.TxOptions{IsoLevel: pgx.Serializable}), WithMergedInserts())
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "O'Brien", nil)
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Bob", "bob@example.com")
+	b.Queue("UPDATE users SET email = NULL WHERE id = $1 AND created < $2 -- cleanup", -5, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	b.Queue("SELECT $1::int[], $2, $3", []int32{1, 2}, []byte{0xde, 0xad}, 1.5)
+	b.QueueCopy(pgx.Identifier{"users"}, []string{"name"}, pgx.CopyFromRows(nil))
+
+	want := "BEGIN ISOLATION LEVEL SERIALIZABLE;\n" +
+		"INSERT INTO users (name, email) VALUES ('O''Brien', NULL), ('Bob', 'bob@example.com');\n" +
+		"UPDATE users SET email = NULL WHERE id = (-5) AND created < '2024-01-02 03:04:05Z'::timestamptz -- cleanup\n;\n" +
+		"SELECT '{1,2}'::\"_int4\"::int[], '\\xdead'::bytea, 1.5::float8;\n" +
+		"-- COPY \"users\" (\"name\") FROM STDIN (rows not rendered)\n" +
+		"COMMIT;\n"
+
+	got, err := b.Render()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got != want {
+		t.Errorf("unexpected script:\n%s\nwant:\n%s", got, want)
+	}
+
+	var buf bytes.Buffer
+	n, err := b.WriteTo(&buf)
+	if err != nil || n != int64(len(want)) || buf.String() != want {
+		t.Errorf("WriteTo wrote %d bytes (%v):\n%s", n, err, buf.String())
+	}
+}
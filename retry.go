@@ -0,0 +1,76 @@
+package pgxbatcher
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// DefaultRetryCodes are the SQLSTATE codes retried when RetryPolicy.Codes is empty: serialization_failure and
+// deadlock_detected.
+var DefaultRetryCodes = []string{"40001", "40P01"}
+
+// RetryPolicy controls how a failed transactional batch is replayed. The whole batch is sent again in a new
+// transaction when it fails with one of the policy's SQLSTATE codes.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times the batch is sent, including the first attempt. Values below 2
+	// disable retries.
+	MaxAttempts int
+	// MinBackoff is the upper bound of the delay before the first retry. It doubles with every further retry.
+	MinBackoff time.Duration
+	// MaxBackoff caps the upper bound of the delay. Zero means no cap.
+	MaxBackoff time.Duration
+	// Codes are the SQLSTATE codes that cause the batch to be retried. DefaultRetryCodes is used if empty.
+	Codes []string
+}
+
+// retryable reports whether err was caused by a PostgreSQL error with one of the policy's codes.
+func (r RetryPolicy) retryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if r.MaxAttempts < 2 || !errors.As(err, &pgErr) {
+		return false
+	}
+
+	codes := r.Codes
+	if len(codes) == 0 {
+		codes = DefaultRetryCodes
+	}
+	return slices.Contains(codes, pgErr.Code)
+}
+
+// backoff returns the delay before the given retry, starting at 1. It uses full jitter: the delay is chosen at random
+// between zero and an exponentially growing upper bound so that competing batches do not retry in lockstep.
+func (r RetryPolicy) backoff(retry int) time.Duration {
+	d := r.MinBackoff
+	for i := 1; i < retry && d > 0 && (r.MaxBackoff <= 0 || d < r.MaxBackoff); i++ {
+		d *= 2
+	}
+	if r.MaxBackoff > 0 && d > r.MaxBackoff {
+		d = r.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return rand.N(d + 1)
+}
+
+// wait sleeps for the backoff of the given retry or until ctx is done.
+func (r RetryPolicy) wait(ctx context.Context, retry int) error {
+	d := r.backoff(retry)
+	if d == 0 {
+		return ctx.Err()
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,429 @@
+package pgxbatcher
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var (
+	// ErrSpooled is wrapped, along with the original error, by the error returned by Execute when a batch failed
+	// because of a connection error and was written to its Spool.
+	ErrSpooled = errors.New("batch spooled for replay")
+	// ErrAlreadyApplied is wrapped by the error returned by Execute when the batch's idempotency key has already been
+	// recorded, i.e. a batch with the same key has been committed before.
+	ErrAlreadyApplied = errors.New("batch already applied")
+)
+
+// DefaultIdempotencyTable is the table in which a Spool records the idempotency keys of committed batches unless
+// WithIdempotencyTable is used. It must be created beforehand:
+//
+//	CREATE TABLE pgxbatcher_idempotency_keys (
+//	    key text PRIMARY KEY,
+//	    applied_at timestamptz NOT NULL DEFAULT now()
+//	)
+var DefaultIdempotencyTable = pgx.Identifier{"pgxbatcher_idempotency_keys"}
+
+// spoolMagic starts every spooled batch file and is followed by the version of its encoding.
+const (
+	spoolMagic   = "PGXS"
+	spoolVersion = 1
+	spoolExt     = ".spool"
+	failedExt    = ".failed"
+)
+
+// Flags of the boolean options of a spooled batch.
+const (
+	spoolMergeInserts byte = 1 << iota
+	spoolPipeline
+)
+
+// Spool is a write-ahead spool for batches that fail because the connection to the database was lost. Such a batch
+// may or may not have been committed, so instead of failing it is written to a file in the spool's directory and
+// replayed by a background worker until the connection is healthy again.
+//
+// Every batch executed with WithSpool records its idempotency key in the idempotency table within its transaction. A
+// replayed batch whose key is already recorded was committed before the connection was lost and is discarded.
+type Spool struct {
+	dir      string
+	conn     BatchSender
+	table    pgx.Identifier
+	interval time.Duration
+	onError  func(key string, err error)
+
+	replaying sync.Mutex
+	mu        sync.Mutex
+	seq       int
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// SpoolOption configures a Spool created with OpenSpool.
+type SpoolOption func(*Spool)
+
+// WithIdempotencyTable sets the table in which idempotency keys are recorded. It defaults to
+// DefaultIdempotencyTable. The table must have a unique text column named key.
+func WithIdempotencyTable(table pgx.Identifier) SpoolOption {
+	return func(s *Spool) {
+		s.table = table
+	}
+}
+
+// WithReplayInterval sets how often the spooled batches are replayed. It defaults to 5s.
+func WithReplayInterval(d time.Duration) SpoolOption {
+	return func(s *Spool) {
+		s.interval = d
+	}
+}
+
+// WithReplayErrorHandler sets a function that is called with the idempotency key of a spooled batch that failed for a
+// reason other than a connection error, such as a constraint violation. Such a batch is not replayed again: its file
+// is renamed with the extension .failed and left in the spool's directory.
+func WithReplayErrorHandler(fn func(key string, err error)) SpoolOption {
+	return func(s *Spool) {
+		s.onError = fn
+	}
+}
+
+// OpenSpool opens the spool in dir, creating the directory if needed, and starts the background worker that replays
+// its batches on conn, beginning with those left by a previous process. conn should be a *pgxpool.Pool, which
+// reconnects once the database is reachable again. Close must be called to stop the worker.
+func OpenSpool(dir string, conn BatchSender, opts ...SpoolOption) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	s := &Spool{
+		dir:      dir,
+		conn:     conn,
+		table:    DefaultIdempotencyTable,
+		interval: 5 * time.Second,
+		done:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+
+	go s.run()
+	return s, nil
+}
+
+// Close stops the background worker, interrupting a replay in progress. Spooled batches stay in the spool's
+// directory.
+func (s *Spool) Close() {
+	s.cancel()
+	<-s.done
+}
+
+func (s *Spool) run() {
+	defer close(s.done)
+
+	t := time.NewTicker(s.interval)
+	defer t.Stop()
+	for {
+		_ = s.Replay(s.ctx)
+
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Replay executes the spooled batches in the order in which they were spooled. It stops at the first batch that fails
+// because of a connection error and returns that error, leaving the batch and those after it for the next replay.
+// Replay is called periodically by the background worker, but can also be called directly.
+func (s *Spool) Replay(ctx context.Context) error {
+	s.replaying.Lock()
+	defer s.replaying.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), spoolExt) {
+			names = append(names, e.Name())
+		}
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		key, err := s.replay(ctx, name)
+		switch {
+		case err == nil || errors.Is(err, ErrAlreadyApplied):
+			if err := os.Remove(filepath.Join(s.dir, name)); err != nil {
+				return err
+			}
+		case ctx.Err() != nil || isConnectionError(err):
+			return err
+		default:
+			failed := strings.TrimSuffix(name, spoolExt) + failedExt
+			if err := os.Rename(filepath.Join(s.dir, name), filepath.Join(s.dir, failed)); err != nil {
+				return err
+			}
+			if s.onError != nil {
+				s.onError(key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// replay executes the batch spooled in the file name and returns its idempotency key.
+func (s *Spool) replay(ctx context.Context, name string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, name))
+	if err != nil {
+		return "", err
+	}
+
+	r := bytes.NewReader(data)
+	header := make([]byte, len(spoolMagic)+1)
+	if _, err := io.ReadFull(r, header); err != nil || string(header[:len(spoolMagic)]) != spoolMagic || header[len(spoolMagic)] != spoolVersion {
+		return "", fmt.Errorf("%w: %s is not a spooled batch", ErrInvalidEncoding, name)
+	}
+	key, opts, err := readSpoolOptions(r)
+	if err != nil {
+		return key, fmt.Errorf("%w: %s: %v", ErrInvalidEncoding, name, err)
+	}
+	batch, err := readBytes(r)
+	if err != nil {
+		return key, fmt.Errorf("%w: %s: %v", ErrInvalidEncoding, name, err)
+	}
+
+	b := NewWithOptions(s.conn, opts...)
+	b.idempotencyKey = key
+	b.idempotencyTable = s.table
+	if err := b.UnmarshalBinary(batch); err != nil {
+		return key, err
+	}
+	return key, b.Execute(ctx)
+}
+
+// append writes p, whose statements are encoded in batch, to a new file in the spool's directory. The file is written
+// under a temporary name and renamed once it has been synced, so that the worker never sees a partial batch.
+func (s *Spool) append(p *PGXBatcher, batch []byte) error {
+	buf := append([]byte(spoolMagic), spoolVersion)
+	buf = appendSpoolOptions(buf, p)
+	buf = binary.AppendUvarint(buf, uint64(len(batch)))
+	buf = append(buf, batch...)
+
+	s.mu.Lock()
+	s.seq++
+	name := fmt.Sprintf("%020d-%06d%s", time.Now().UnixNano(), s.seq%1_000_000, spoolExt)
+	s.mu.Unlock()
+
+	f, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(buf); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), filepath.Join(s.dir, name)); err != nil {
+		return err
+	}
+
+	d, err := os.Open(s.dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// appendSpoolOptions appends the idempotency key of p and the options that affect how its statements are executed, so
+// that the batch is replayed the way it was executed. Options holding functions, such as a tracer or a progress
+// function, cannot be encoded and are not replayed.
+func appendSpoolOptions(buf []byte, p *PGXBatcher) []byte {
+	buf = appendString(buf, p.idempotencyKey)
+	buf = appendString(buf, p.beginSQL())
+	buf = appendString(buf, p.commitSQL())
+	buf = binary.AppendUvarint(buf, uint64(p.errorMode))
+
+	var flags byte
+	if p.mergeInserts {
+		flags |= spoolMergeInserts
+	}
+	if p.pipeline {
+		flags |= spoolPipeline
+	}
+	buf = append(buf, flags)
+
+	buf = binary.AppendVarint(buf, int64(p.maxStatements))
+	buf = binary.AppendVarint(buf, int64(p.maxBytes))
+	buf = binary.AppendVarint(buf, int64(p.retryPolicy.MaxAttempts))
+	buf = binary.AppendVarint(buf, int64(p.retryPolicy.MinBackoff))
+	buf = binary.AppendVarint(buf, int64(p.retryPolicy.MaxBackoff))
+	buf = binary.AppendUvarint(buf, uint64(len(p.retryPolicy.Codes)))
+	for _, code := range p.retryPolicy.Codes {
+		buf = appendString(buf, code)
+	}
+	return buf
+}
+
+// readSpoolOptions reads the idempotency key and options written by appendSpoolOptions.
+func readSpoolOptions(r *bytes.Reader) (string, []Option, error) {
+	var strs [3]string
+	for j := range strs {
+		s, err := readString(r)
+		if err != nil {
+			return "", nil, err
+		}
+		strs[j] = s
+	}
+	key, begin, commit := strs[0], strs[1], strs[2]
+
+	mode, err := binary.ReadUvarint(r)
+	if err != nil {
+		return key, nil, err
+	}
+	flags, err := r.ReadByte()
+	if err != nil {
+		return key, nil, err
+	}
+	var ints [5]int64
+	for j := range ints {
+		if ints[j], err = binary.ReadVarint(r); err != nil {
+			return key, nil, err
+		}
+	}
+	n, err := binary.ReadUvarint(r)
+	if err != nil || n > uint64(r.Len()) {
+		return key, nil, errors.New("invalid number of retry codes")
+	}
+	var codes []string
+	for range n {
+		code, err := readString(r)
+		if err != nil {
+			return key, nil, err
+		}
+		codes = append(codes, code)
+	}
+
+	opts := []Option{
+		WithTxOptions(pgx.TxOptions{BeginQuery: begin, CommitQuery: commit}),
+		WithErrorMode(ErrorMode(mode)),
+		WithMaxStatementsPerRoundTrip(int(ints[0])),
+		WithMaxBytesPerRoundTrip(int(ints[1])),
+		WithRetryPolicy(RetryPolicy{
+			MaxAttempts: int(ints[2]),
+			MinBackoff:  time.Duration(ints[3]),
+			MaxBackoff:  time.Duration(ints[4]),
+			Codes:       codes,
+		}),
+	}
+	if flags&spoolMergeInserts != 0 {
+		opts = append(opts, WithMergedInserts())
+	}
+	if flags&spoolPipeline != 0 {
+		opts = append(opts, WithPipeline())
+	}
+	return key, opts, nil
+}
+
+// WithSpool makes the batch transactional and writes it to spool if it fails because of a connection error, so that
+// it is replayed later. key identifies the batch: it is recorded in the spool's idempotency table within the batch's
+// transaction, so that a batch whose commit was lost along with the connection is not applied twice. If key is empty
+// a random key is generated for each batch. Executing a batch whose key is already recorded fails with
+// ErrAlreadyApplied. Keys are never removed from the idempotency table, so old keys should be deleted periodically,
+// e.g. by their applied_at time, once no spooled batch can still carry them. WithSpool has no effect if spool is nil.
+//
+// Only batches whose statements were all queued with Queue can be spooled, see MarshalBinary. The batch is replayed
+// with its transaction, error mode, round trip limits, merged inserts, pipeline mode and retry policy, but without
+// options that take functions, such as a tracer, a logger or a progress function. WithSpool has no effect on a batch
+// created with NewInTx.
+func WithSpool(spool *Spool, key string) Option {
+	return func(p *PGXBatcher) {
+		if spool == nil {
+			return
+		}
+		k := key
+		if k == "" {
+			b := make([]byte, 16)
+			_, _ = rand.Read(b)
+			k = hex.EncodeToString(b)
+		}
+		p.transactional = true
+		p.spool = spool
+		p.idempotencyKey = k
+		p.idempotencyTable = spool.table
+	}
+}
+
+// claim returns the step that records the batch's idempotency key, if it has one.
+func (p *PGXBatcher) claim() []step {
+	if p.idempotencyKey == "" {
+		return nil
+	}
+	sql := "INSERT INTO " + p.idempotencyTable.Sanitize() + " (key) VALUES ($1)"
+	return []step{{sql: sql, args: []any{p.idempotencyKey}}}
+}
+
+// alreadyApplied reports whether err was caused by the batch's idempotency key having been recorded before.
+func (p *PGXBatcher) alreadyApplied(err error) bool {
+	var pgErr *pgconn.PgError
+	var stmtErr *StatementError
+	return p.idempotencyKey != "" && !errors.As(err, &stmtErr) && errors.As(err, &pgErr) &&
+		pgErr.Code == "23505" && pgErr.TableName == p.idempotencyTable[len(p.idempotencyTable)-1] // unique_violation
+}
+
+// spoolBatch writes the batch, which failed with the connection error err, to its spool.
+func (p *PGXBatcher) spoolBatch(err error) error {
+	data, mErr := p.MarshalBinary()
+	if mErr == nil {
+		mErr = p.spool.append(p, data)
+	}
+	if mErr != nil {
+		return errors.Join(err, fmt.Errorf("could not spool batch: %w", mErr))
+	}
+	return fmt.Errorf("%w: %w", ErrSpooled, err)
+}
+
+// isConnectionError reports whether err was caused by the connection to the database rather than by the server
+// rejecting a statement, in which case err wraps a *pgconn.PgError. A canceled or expired context is not a connection
+// error, even though context.DeadlineExceeded implements net.Error.
+func isConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var connectErr *pgconn.ConnectError
+	var netErr net.Error
+	return errors.As(err, &connectErr) || errors.As(err, &netErr) || errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || pgconn.SafeToRetry(err)
+}
@@ -0,0 +1,173 @@
+package pgxbatcher
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestSpool(t *testing.T) {
+	_, err := conn.Exec(context.TODO(), "CREATE TABLE IF NOT EXISTS pgxbatcher_idempotency_keys (key text PRIMARY KEY, applied_at timestamptz NOT NULL DEFAULT now())")
+	if err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+	t.Cleanup(func() {
+		_, _ = conn.Exec(context.TODO(), "DROP TABLE pgxbatcher_idempotency_keys")
+		truncateUsers(t)
+	})
+
+	// A pool for a server that is not listening fails every batch with a connection error.
+	down, err := pgxpool.New(context.TODO(), "postgres://user@127.0.0.1:1/db?connect_timeout=1")
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+	defer down.Close()
+
+	// The spool's worker replays on the pool that is down, so it cannot apply a batch while the test uses conn.
+	dir := t.TempDir()
+	spool, err := OpenSpool(dir, down, WithReplayInterval(time.Hour))
+	if err != nil {
+		t.Fatalf("failed to open spool: %v", err)
+	}
+	defer spool.Close()
+
+	// A batch that fails because the caller's deadline expired is not spooled.
+	ctx, cancel := context.WithDeadline(context.TODO(), time.Now().Add(-time.Second))
+	defer cancel()
+	b := NewWithOptions(down, WithSpool(spool, "expired"))
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Alice", "alice@example.com")
+	if err := b.Execute(ctx); err == nil || errors.Is(err, ErrSpooled) {
+		t.Fatalf("expected the batch to fail without being spooled, got %v", err)
+	}
+
+	b = NewWithOptions(down, WithSpool(spool, "alice"))
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Alice", "alice@example.com")
+	if err := b.Execute(context.TODO()); !errors.Is(err, ErrSpooled) {
+		t.Fatalf("expected ErrSpooled, got %v", err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.spool"))
+	if len(files) != 1 {
+		t.Fatalf("expected one spooled batch, got %d", len(files))
+	}
+
+	// The same batch executed again once the database is reachable is applied only once.
+	b = NewWithOptions(conn, WithSpool(spool, "alice"))
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Alice", "alice@example.com")
+	if err := b.Execute(context.TODO()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	b = NewWithOptions(conn, WithSpool(spool, "bob"))
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Bob", "bob@example.com")
+	if err := b.Execute(context.TODO()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The spool is replayed by a process that can reach the database, on a pool of its own.
+	up, err := pgxpool.New(context.TODO(), databaseURL())
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+	defer up.Close()
+	replayer, err := OpenSpool(dir, up, WithReplayInterval(time.Hour))
+	if err != nil {
+		t.Fatalf("failed to open spool: %v", err)
+	}
+	defer replayer.Close()
+
+	// The worker may have replayed the spool already, in which case there is nothing left to replay.
+	if err := replayer.Replay(context.TODO()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	files, _ = filepath.Glob(filepath.Join(dir, "*"))
+	if len(files) != 0 {
+		t.Errorf("expected the spool to be empty, got %v", files)
+	}
+
+	var count int
+	if err := conn.QueryRow(context.TODO(), "SELECT COUNT(*) FROM users").Scan(&count); err != nil {
+		t.Fatalf("Failed to query test table: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 rows, got %d", count)
+	}
+
+	b = NewWithOptions(conn, WithSpool(spool, "bob"))
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Bob", "bob@example.com")
+	if err := b.Execute(context.TODO()); !errors.Is(err, ErrAlreadyApplied) {
+		t.Errorf("expected ErrAlreadyApplied, got %v", err)
+	}
+}
+
+func TestIsConnectionError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{io.ErrUnexpectedEOF, true},
+		{&os.SyscallError{Syscall: "read", Err: os.ErrDeadlineExceeded}, true},
+		{&pgconn.PgError{Code: "23505"}, false},
+		{context.Canceled, false},
+		{context.DeadlineExceeded, false},
+		{fmt.Errorf("timeout: %w", context.DeadlineExceeded), false},
+		{errors.New("statement failed"), false},
+	}
+	for _, tt := range tests {
+		if got := isConnectionError(tt.err); got != tt.want {
+			t.Errorf("isConnectionError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestSpoolOptions(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond, MaxBackoff: time.Second, Codes: []string{"40001"}}
+	p := NewWithOptions(nil,
+		WithTxOptions(pgx.TxOptions{IsoLevel: pgx.Serializable}),
+		WithErrorMode(ContinueOnError),
+		WithMaxStatementsPerRoundTrip(100),
+		WithMaxBytesPerRoundTrip(1<<20),
+		WithMergedInserts(),
+		WithPipeline(),
+		WithRetryPolicy(policy),
+	)
+	p.idempotencyKey = "alice"
+
+	key, opts, err := readSpoolOptions(bytes.NewReader(appendSpoolOptions(nil, p)))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	r := NewWithOptions(nil, opts...)
+	if key != "alice" || !r.transactional || r.beginSQL() != "BEGIN ISOLATION LEVEL SERIALIZABLE" || r.commitSQL() != "COMMIT" {
+		t.Errorf("expected the transaction to be restored, got key %q, begin %q, commit %q", key, r.beginSQL(), r.commitSQL())
+	}
+	if r.errorMode != ContinueOnError || r.maxStatements != 100 || r.maxBytes != 1<<20 || !r.mergeInserts || !r.pipeline {
+		t.Errorf("expected the execution options to be restored, got %+v", r)
+	}
+	if !reflect.DeepEqual(r.retryPolicy, policy) {
+		t.Errorf("expected retry policy %+v, got %+v", policy, r.retryPolicy)
+	}
+}
+
+func TestWithSpool(t *testing.T) {
+	spool := &Spool{table: DefaultIdempotencyTable}
+	opt := WithSpool(spool, "")
+	a, b := NewWithOptions(nil, opt), NewWithOptions(nil, opt)
+	if a.idempotencyKey == "" || a.idempotencyKey == b.idempotencyKey {
+		t.Errorf("expected distinct random keys, got %q and %q", a.idempotencyKey, b.idempotencyKey)
+	}
+
+	if p := NewWithOptions(nil, WithSpool(nil, "alice")); p.spool != nil || p.idempotencyKey != "" {
+		t.Errorf("expected a nil spool to have no effect, got key %q", p.idempotencyKey)
+	}
+}
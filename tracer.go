@@ -0,0 +1,86 @@
+package pgxbatcher
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Tracer traces the execution of a batch. It is modeled on pgx.BatchTracer but is set on a single PGXBatcher with
+// WithTracer rather than on the connection, and reports statements by their index in the batch. Use BatchTracer to
+// trace a batch with an existing pgx.BatchTracer.
+type Tracer interface {
+	// TraceBatchStart is called at the beginning of Execute. The returned context is used for the rest of the call and
+	// is passed to TraceBatchQuery and TraceBatchEnd.
+	TraceBatchStart(ctx context.Context, data TraceBatchStartData) context.Context
+	// TraceBatchQuery is called when the result of a statement has been read. Statements that are sent again, e.g.
+	// when the batch is retried, are traced again. With WithConcurrentChunks it may be called concurrently.
+	TraceBatchQuery(ctx context.Context, data TraceBatchQueryData)
+	// TraceBatchEnd is called at the end of Execute.
+	TraceBatchEnd(ctx context.Context, data TraceBatchEndData)
+}
+
+type TraceBatchStartData struct {
+	// Batch holds the queued statements. It must not be modified.
+	Batch         *pgx.Batch
+	Transactional bool
+}
+
+type TraceBatchQueryData struct {
+	// Index is the position of the statement in the batch.
+	Index      int
+	SQL        string
+	Args       []any
+	CommandTag pgconn.CommandTag
+	Err        error
+}
+
+type TraceBatchEndData struct {
+	Err error
+}
+
+// BatchTracer returns a Tracer that traces a batch with t. conn is passed to t's methods and may be nil.
+func BatchTracer(t pgx.BatchTracer, conn *pgx.Conn) Tracer {
+	return &batchTracer{tracer: t, conn: conn}
+}
+
+type batchTracer struct {
+	tracer pgx.BatchTracer
+	conn   *pgx.Conn
+}
+
+func (t *batchTracer) TraceBatchStart(ctx context.Context, data TraceBatchStartData) context.Context {
+	return t.tracer.TraceBatchStart(ctx, t.conn, pgx.TraceBatchStartData{Batch: data.Batch})
+}
+
+func (t *batchTracer) TraceBatchQuery(ctx context.Context, data TraceBatchQueryData) {
+	t.tracer.TraceBatchQuery(ctx, t.conn, pgx.TraceBatchQueryData{
+		SQL:        data.SQL,
+		Args:       data.Args,
+		CommandTag: data.CommandTag,
+		Err:        data.Err,
+	})
+}
+
+func (t *batchTracer) TraceBatchEnd(ctx context.Context, data TraceBatchEndData) {
+	t.tracer.TraceBatchEnd(ctx, t.conn, pgx.TraceBatchEndData{Err: data.Err})
+}
+
+// traceStatements reports the results of the statements executed by s to the batch's tracer.
+func (p *PGXBatcher) traceStatements(ctx context.Context, s step) {
+	if p.tracer == nil {
+		return
+	}
+
+	for _, i := range s.indexes {
+		res := p.statements[i].result
+		p.tracer.TraceBatchQuery(ctx, TraceBatchQueryData{
+			Index:      i,
+			SQL:        p.queries[i],
+			Args:       p.batch.QueuedQueries[i].Arguments,
+			CommandTag: res.CommandTag,
+			Err:        res.Err,
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package pgxbatcher
+
+import (
+	"context"
+	"testing"
+)
+
+type recordingTracer struct {
+	started bool
+	queries []TraceBatchQueryData
+	end     *TraceBatchEndData
+}
+
+func (t *recordingTracer) TraceBatchStart(ctx context.Context, data TraceBatchStartData) context.Context {
+	t.started = data.Batch.Len() == 3 && data.Transactional
+	return ctx
+}
+
+func (t *recordingTracer) TraceBatchQuery(ctx context.Context, data TraceBatchQueryData) {
+	t.queries = append(t.queries, data)
+}
+
+func (t *recordingTracer) TraceBatchEnd(ctx context.Context, data TraceBatchEndData) {
+	t.end = &data
+}
+
+func TestPGXBatcher_WithTracer(t *testing.T) {
+	t.Cleanup(func() { truncateUsers(t) })
+
+	tracer := &recordingTracer{}
+	b := NewWithOptions(conn, WithTransactional(true), WithErrorMode(ContinueOnError), WithTracer(tracer))
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Alice", "alice@example.com")
+	b.Queue("SELECT $1::int / 0", 5)
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Bob", "bob@example.com")
+
+	err := b.Execute(context.TODO())
+	if err == nil {
+		t.Fatal("expected an error, but got none")
+	}
+
+	if !tracer.started {
+		t.Error("expected batch start to be traced with the queued batch")
+	}
+	if len(tracer.queries) != 3 {
+		t.Fatalf("expected 3 traced statements, got %d", len(tracer.queries))
+	}
+	for i, q := range tracer.queries {
+		if q.Index != i || q.SQL != b.queries[i] {
+			t.Errorf("unexpected trace for statement %d: %+v", i, q)
+		}
+	}
+	if !tracer.queries[0].CommandTag.Insert() || tracer.queries[1].Err == nil || tracer.queries[2].Err != nil {
+		t.Errorf("unexpected traced results: %+v", tracer.queries)
+	}
+	if tracer.end == nil || tracer.end.Err != err {
+		t.Errorf("expected batch end to be traced with %v, got %+v", err, tracer.end)
+	}
+}
@@ -0,0 +1,149 @@
+package pgxbatcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// preparer is implemented by connections that can describe the statements checked by Validate.
+type preparer interface {
+	Prepare(ctx context.Context, name, sql string) (*pgconn.StatementDescription, error)
+}
+
+// Validate asks the server to describe every distinct queued statement without executing any of them. Statements that
+// would fail to parse or plan, e.g. because of a syntax error or an unknown table or column, or whose number of
+// arguments does not match their placeholders, are reported as StatementErrors. A COPY queued with QueueCopy is not
+// checked. As with Execute, invalid Refs are reported with an error wrapping ErrInvalidRef before anything is sent.
+//
+// Validate does not execute the batch, so it can be called before Execute to avoid a non-transactional batch being
+// applied in part. Within a transaction passed to NewInTx the statements are described inside a savepoint, so that a
+// failing statement does not abort the transaction. The connection must support Prepare, as *pgx.Conn and pgx.Tx do,
+// or be a pool such as *pgxpool.Pool, see BatchSender.
+func (p *PGXBatcher) Validate(ctx context.Context) error {
+	if len(p.queries) < 1 {
+		return ErrEmptyBatch
+	}
+	if err := p.checkRefs(); err != nil {
+		return err
+	}
+
+	if pool, ok := p.conn.(acquirer); ok {
+		c, err := pool.Acquire(ctx)
+		if err != nil {
+			return err
+		}
+		defer c.Release()
+		return p.on(c).validate(ctx)
+	}
+	return p.validate(ctx)
+}
+
+// validate describes the queued statements on the batch's connection, inside a savepoint within a transaction passed
+// to NewInTx.
+func (p *PGXBatcher) validate(ctx context.Context) error {
+	conn, ok := p.preparer()
+	if !ok {
+		return ErrPrepareUnsupported
+	}
+	if !p.inTx {
+		return p.describeStatements(ctx, conn)
+	}
+
+	if _, err := p.run(ctx, []step{control("SAVEPOINT " + savepoint)}); err != nil {
+		return err
+	}
+	err := p.describeStatements(ctx, conn)
+	if _, rbErr := p.run(ctx, []step{control("ROLLBACK TO SAVEPOINT " + savepoint), control("RELEASE SAVEPOINT " + savepoint)}); rbErr != nil && err == nil {
+		err = rbErr
+	}
+	return err
+}
+
+// preparer returns the batch's connection as a preparer. A connection acquired from a pool provides one with its Conn
+// method.
+func (p *PGXBatcher) preparer() (preparer, bool) {
+	if conn, ok := p.conn.(preparer); ok {
+		return conn, true
+	}
+	if conn, ok := pipelineConn(p.conn); ok && conn != nil {
+		return conn, true
+	}
+	return nil, false
+}
+
+// describeStatements describes the queued statements on conn and returns the failures as StatementErrors. Each
+// distinct SQL is described once.
+func (p *PGXBatcher) describeStatements(ctx context.Context, conn preparer) error {
+	descriptions := map[string]*pgconn.StatementDescription{}
+	describeErrs := map[string]error{}
+
+	var errs StatementErrors
+	for i, s := range p.statements {
+		if s.copy != nil {
+			continue
+		}
+
+		sql, args, err := p.rewrite(ctx, i)
+		if err != nil {
+			errs = append(errs, p.validationError(i, err))
+			continue
+		}
+
+		sd, described := descriptions[sql]
+		err = describeErrs[sql]
+		if !described && err == nil {
+			sd, err = conn.Prepare(ctx, "", sql)
+			if err != nil {
+				var pgErr *pgconn.PgError
+				if !errors.As(err, &pgErr) {
+					// The error did not come from the server, e.g. a lost connection, so it says nothing about
+					// the statement.
+					return err
+				}
+				describeErrs[sql] = err
+			} else {
+				descriptions[sql] = sd
+			}
+		}
+		if err != nil {
+			errs = append(errs, p.validationError(i, err))
+			continue
+		}
+
+		if len(sd.ParamOIDs) != len(args) {
+			err = fmt.Errorf("statement has %d placeholders but %d arguments were given", len(sd.ParamOIDs), len(args))
+			errs = append(errs, p.validationError(i, err))
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// rewrite returns the SQL and arguments of statement i after applying a pgx.QueryRewriter passed as its first
+// argument, such as pgx.NamedArgs.
+func (p *PGXBatcher) rewrite(ctx context.Context, i int) (string, []any, error) {
+	qq := p.batch.QueuedQueries[i]
+	sql, args := qq.SQL, qq.Arguments
+	if len(args) > 0 {
+		if qr, ok := args[0].(pgx.QueryRewriter); ok {
+			return qr.RewriteQuery(ctx, nil, sql, args[1:])
+		}
+	}
+	return sql, args, nil
+}
+
+func (p *PGXBatcher) validationError(i int, err error) *StatementError {
+	return &StatementError{
+		Index: i,
+		SQL:   p.queries[i],
+		Args:  p.redact(i),
+		Err:   err,
+	}
+}
@@ -0,0 +1,61 @@
+package pgxbatcher
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestPGXBatcher_Validate(t *testing.T) {
+	t.Cleanup(func() { truncateUsers(t) })
+
+	b := New(conn, false)
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Alice", "alice@example.com")
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Bob")
+	b.Queue("SELECT nme FROM users")
+	b.Queue("SELEC 1")
+
+	err := b.Validate(context.TODO())
+
+	var stmtErrs StatementErrors
+	if !errors.As(err, &stmtErrs) || len(stmtErrs) != 3 {
+		t.Fatalf("expected three statement errors, got %v", err)
+	}
+	codes := []string{"", "42703", "42601"} // undefined_column, syntax_error
+	for j, want := range []int{1, 2, 3} {
+		var stmtErr *StatementError
+		if !errors.As(stmtErrs[j], &stmtErr) || stmtErr.Index != want {
+			t.Errorf("expected statement %d to fail, got %v", want, stmtErrs[j])
+			continue
+		}
+		var pgErr *pgconn.PgError
+		if codes[j] != "" && (!errors.As(stmtErr, &pgErr) || pgErr.Code != codes[j]) {
+			t.Errorf("expected statement %d to fail with %s, got %v", want, codes[j], stmtErr.Err)
+		}
+	}
+
+	var count int
+	if err := conn.QueryRow(context.TODO(), "SELECT COUNT(*) FROM users").Scan(&count); err != nil {
+		t.Fatalf("Failed to query test table: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("expected no statement to be executed, got %d rows", count)
+	}
+
+	b = New(conn, true)
+	b.Queue("INSERT INTO users (name, email) VALUES ($1, $2)", "Alice", "alice@example.com")
+	if err := b.Validate(context.TODO()); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	// Refs are checked as by Execute
+	other := New(conn, true)
+	user := other.Queue("INSERT INTO users (name, email) VALUES ($1, $2) RETURNING id", "Bob", "bob@example.com")
+	b = New(conn, true)
+	b.Queue("UPDATE users SET name = $1 WHERE id = $2", "Carol", user.Ref("id"))
+	if err := b.Validate(context.TODO()); !errors.Is(err, ErrInvalidRef) {
+		t.Errorf("expected ErrInvalidRef, got %v", err)
+	}
+}